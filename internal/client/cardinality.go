@@ -0,0 +1,715 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// CardinalityOptions control how EvaluateCardinalities queries the Prometheus instance.
+type CardinalityOptions struct {
+
+	// Parallelism is the number of queries in flight at once.
+	Parallelism int
+
+	// Retries is the number of times a query that failed with a 5xx or 429 is retried, with exponential backoff.
+	Retries int
+
+	// QueryTimeout bounds every attempt of a query.
+	QueryTimeout time.Duration
+
+	// RateLimit is the number of queries per second, across all workers. Zero means unlimited.
+	RateLimit float64
+
+	// Lookback is the window over which the cardinalities are evaluated, at every Step, through range queries. Zero
+	// means that they are only evaluated at the current time.
+	Lookback time.Duration
+
+	// Step is the resolution of the range queries.
+	Step time.Duration
+}
+
+// DefaultCardinalityOptions are the options that EvaluateCardinalities uses, unless set otherwise.
+var DefaultCardinalityOptions = CardinalityOptions{
+	Parallelism:  8,
+	Retries:      3,
+	QueryTimeout: 30 * time.Second,
+	Step:         time.Hour,
+}
+
+const (
+
+	// initialBackoff is the time to wait before the first retry of a query, doubled for every subsequent one.
+	initialBackoff = 500 * time.Millisecond
+
+	// maxBatchRegexLength bounds the length of the metric name regex within a batched query, so that the query stays
+	// well under the URL length limits of the Prometheus instance, and any proxies in between.
+	maxBatchRegexLength = 2048
+
+	// tsdbStatusLimit is the number of metric names requested from the TSDB status API.
+	tsdbStatusLimit = 10000
+
+	// MaxRangePoints is the maximum number of points per series that Prometheus returns for a range query.
+	MaxRangePoints = 11000
+)
+
+// SetCardinalityOptions sets the options that EvaluateCardinalities uses.
+func (c *Client) SetCardinalityOptions(options CardinalityOptions) {
+	c.cardinalityOptions = options
+}
+
+// CardinalValue is the cardinality of a metric, or the error encountered while evaluating it.
+type CardinalValue struct {
+	Metric string
+	Value  uint
+	Err    error
+
+	// Range is the cardinality of the metric over the lookback window, if set.
+	Range *CardinalityRange
+}
+
+// CardinalityRange summarizes the cardinality of a metric at every step of the lookback window. Steps at which the
+// metric had no series count as zero.
+type CardinalityRange struct {
+	Min uint
+	Avg float64
+	Max uint
+	P95 uint
+}
+
+// AbsentNow returns true if the metric had series within the lookback window, but has none at the current time.
+func (cv CardinalValue) AbsentNow() bool {
+	return cv.Err == nil && cv.Range != nil && cv.Range.Max > 0 && cv.Value == 0
+}
+
+// EvaluateCardinalities evaluates the cardinality of every metric within the set, and returns them sorted by
+// cardinality in descending order. Metrics that are absent from the TSDB head, as reported by the TSDB status API, are
+// known to have no series without querying them. The rest are evaluated in batches, by a single count query grouped by
+// metric name per batch, through a pool of workers. Metrics within a batch that failed are evaluated one by one. If a
+// lookback window is set, the cardinalities are evaluated over it through range queries instead, in which case all
+// metrics are queried, as the ones absent from the TSDB head may still have had series earlier within the window.
+func (c *Client) EvaluateCardinalities(ctx context.Context, metricSet *sets.Set[string]) []CardinalValue {
+	cardinalities := make([]CardinalValue, 0, metricSet.Len())
+	metrics := sets.List(*metricSet)
+	headMetrics, err := c.headMetrics(ctx)
+	if c.cardinalityOptions.Lookback > 0 {
+		err = errors.New("the lookback window exceeds the TSDB head")
+	}
+	if err != nil {
+		klog.V(1).Infof("querying all metrics, since the metrics within the TSDB head could not be determined: %v", err)
+	} else {
+		var present []string
+		for _, m := range metrics {
+			if headMetrics.Has(m) {
+				present = append(present, m)
+			} else {
+				cardinalities = append(cardinalities, CardinalValue{Metric: m})
+			}
+		}
+		metrics = present
+	}
+
+	batches := batchMetrics(metrics)
+	batchCardinalities := make([][]CardinalValue, len(batches))
+	c.parallelize(len(batches), func(limiter *rate.Limiter, i int) {
+		batchCardinalities[i] = c.evaluateBatch(ctx, limiter, batches[i])
+	})
+	for _, b := range batchCardinalities {
+		cardinalities = append(cardinalities, b...)
+	}
+	sort.Slice(cardinalities, func(i, j int) bool {
+		if cardinalities[i].Value != cardinalities[j].Value {
+			return cardinalities[i].Value > cardinalities[j].Value
+		}
+
+		return cardinalities[i].Metric < cardinalities[j].Metric
+	})
+
+	return cardinalities
+}
+
+// parallelize calls work for every job out of n, through a pool of workers, and returns once all of them are done.
+// Every worker shares the same rate limiter, if any, which is to be waited on before every query.
+func (c *Client) parallelize(n int, work func(*rate.Limiter, int)) {
+	parallelism := c.cardinalityOptions.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var limiter *rate.Limiter
+	if c.cardinalityOptions.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(c.cardinalityOptions.RateLimit), 1)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				work(limiter, job)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// batchMetrics splits the metrics into batches whose name regex stays within maxBatchRegexLength.
+func batchMetrics(metrics []string) [][]string {
+	var batches [][]string
+	var batch []string
+	length := 0
+	for _, m := range metrics {
+		quotedLength := len(regexp.QuoteMeta(m)) + 1
+		if len(batch) > 0 && length+quotedLength > maxBatchRegexLength {
+			batches = append(batches, batch)
+			batch, length = nil, 0
+		}
+		batch = append(batch, m)
+		length += quotedLength
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// evaluateBatch returns the cardinality of every metric within the batch, falling back to evaluating them one by one
+// if the batched query failed.
+func (c *Client) evaluateBatch(ctx context.Context, limiter *rate.Limiter, batch []string) []CardinalValue {
+	if c.cardinalityOptions.Lookback > 0 {
+		return c.evaluateRangeBatch(ctx, limiter, batch)
+	}
+	cardinalValues := make([]CardinalValue, 0, len(batch))
+	var cardinalities map[string]uint
+	err := c.withRetries(ctx, limiter, func(ctx context.Context) error {
+		var err error
+		cardinalities, err = c.getCardinalityForMetrics(ctx, batch)
+
+		return err
+	})
+	if err == nil {
+		for _, m := range batch {
+			cardinalValues = append(cardinalValues, CardinalValue{Metric: m, Value: cardinalities[m]})
+		}
+
+		return cardinalValues
+	}
+	klog.V(1).Infof("evaluating %d metrics one by one, since their batched cardinality query failed: %v", len(batch), err)
+	for _, m := range batch {
+		var cardinality uint
+		err := c.withRetries(ctx, limiter, func(ctx context.Context) error {
+			var err error
+			cardinality, err = c.getCardinalityForMetric(ctx, &parser.VectorSelector{Name: m})
+
+			return err
+		})
+		cardinalValues = append(cardinalValues, CardinalValue{Metric: m, Value: cardinality, Err: err})
+	}
+
+	return cardinalValues
+}
+
+// evaluateRangeBatch returns the cardinality of every metric within the batch over the lookback window, falling back to
+// evaluating them one by one if the batched query failed.
+func (c *Client) evaluateRangeBatch(ctx context.Context, limiter *rate.Limiter, batch []string) []CardinalValue {
+	cardinalValues := make([]CardinalValue, 0, len(batch))
+	var steps map[string][]float64
+	err := c.withRetries(ctx, limiter, func(ctx context.Context) error {
+		var err error
+		steps, err = c.getCardinalityRangeForMetrics(ctx, batch)
+
+		return err
+	})
+	if err == nil {
+		for _, m := range batch {
+			cardinalValues = append(cardinalValues, toCardinalValue(m, steps[m]))
+		}
+
+		return cardinalValues
+	}
+	klog.V(1).Infof("evaluating %d metrics one by one, since their batched cardinality range query failed: %v", len(batch), err)
+	for _, m := range batch {
+		err := c.withRetries(ctx, limiter, func(ctx context.Context) error {
+			var err error
+			steps, err = c.getCardinalityRangeForMetrics(ctx, []string{m})
+
+			return err
+		})
+		if err != nil {
+			cardinalValues = append(cardinalValues, CardinalValue{Metric: m, Err: err})
+
+			continue
+		}
+		cardinalValues = append(cardinalValues, toCardinalValue(m, steps[m]))
+	}
+
+	return cardinalValues
+}
+
+// toCardinalValue summarizes the cardinality of the metric at every step of the lookback window, the last of which is
+// the current one. A metric without any series has no steps.
+func toCardinalValue(metric string, steps []float64) CardinalValue {
+	if len(steps) == 0 {
+		return CardinalValue{Metric: metric, Range: &CardinalityRange{}}
+	}
+	sorted := make([]float64, len(steps))
+	copy(sorted, steps)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return CardinalValue{
+		Metric: metric,
+		Value:  uint(steps[len(steps)-1]),
+		Range: &CardinalityRange{
+			Min: uint(sorted[0]),
+			Avg: sum / float64(len(sorted)),
+			Max: uint(sorted[len(sorted)-1]),
+			P95: uint(sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]),
+		},
+	}
+}
+
+// withRetries runs the query, retrying it with exponential backoff if the failure is transient, and waiting on the
+// limiter, if any, before every attempt. Throttled queries are retried after the time the Prometheus instance asked
+// for, if it is longer than the backoff.
+func (c *Client) withRetries(ctx context.Context, limiter *rate.Limiter, query func(context.Context) error) error {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		if limiter != nil {
+			err := limiter.Wait(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to wait for rate limiter: %w", err)
+			}
+		}
+		err := query(ctx)
+		if err == nil || attempt >= c.cardinalityOptions.Retries || !isRetryable(err) {
+			return err
+		}
+		wait := backoff
+		var throttledErr *ThrottledError
+		if errors.As(err, &throttledErr) && throttledErr.RetryAfter > wait {
+			wait = throttledErr.RetryAfter
+		}
+		klog.V(1).Infof("retrying in %s: %v", wait, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up retrying: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable returns true if the query failed due to a server error (5xx), or was throttled (429).
+func isRetryable(err error) bool {
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return true
+	}
+	var apiErr *v1.Error
+
+	return errors.As(err, &apiErr) && apiErr.Type == v1.ErrServer
+}
+
+// withQueryTimeout bounds ctx by the query timeout, if any.
+func (c *Client) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cardinalityOptions.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, c.cardinalityOptions.QueryTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+func (c *Client) getCardinalityForMetric(ctx context.Context, metric *parser.VectorSelector) (uint, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	query := fmt.Sprintf("count(%s)", metric)
+	r, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", query, err)
+	}
+	v, ok := r.(model.Vector)
+	if !ok {
+		return 0, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+	}
+	cardinality := uint(0)
+	for _, sample := range v {
+		cardinality += uint(sample.Value)
+	}
+
+	return cardinality, nil
+}
+
+// getCardinalityForMetrics returns the cardinality of every metric with series, out of the given ones, through a
+// single count query grouped by metric name.
+func (c *Client) getCardinalityForMetrics(ctx context.Context, metrics []string) (map[string]uint, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	quoted := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		quoted = append(quoted, regexp.QuoteMeta(m))
+	}
+	matcher, err := labels.NewMatcher(labels.MatchRegexp, model.MetricNameLabel, strings.Join(quoted, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric name matcher: %w", err)
+	}
+	query := (&parser.AggregateExpr{
+		Op:       parser.COUNT,
+		Expr:     &parser.VectorSelector{LabelMatchers: []*labels.Matcher{matcher}},
+		Grouping: []string{model.MetricNameLabel},
+	}).String()
+	r, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", query, err)
+	}
+	v, ok := r.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+	}
+	cardinalities := map[string]uint{}
+	for _, sample := range v {
+		cardinalities[string(sample.Metric[model.MetricNameLabel])] += uint(sample.Value)
+	}
+
+	return cardinalities, nil
+}
+
+// getCardinalityRangeForMetrics returns the cardinality of every metric with series within the lookback window, out of
+// the given ones, at every step of it, through a single count range query grouped by metric name. Steps at which a
+// metric had no series are set to zero.
+func (c *Client) getCardinalityRangeForMetrics(ctx context.Context, metrics []string) (map[string][]float64, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	quoted := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		quoted = append(quoted, regexp.QuoteMeta(m))
+	}
+	matcher, err := labels.NewMatcher(labels.MatchRegexp, model.MetricNameLabel, strings.Join(quoted, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric name matcher: %w", err)
+	}
+	query := (&parser.AggregateExpr{
+		Op:       parser.COUNT,
+		Expr:     &parser.VectorSelector{LabelMatchers: []*labels.Matcher{matcher}},
+		Grouping: []string{model.MetricNameLabel},
+	}).String()
+	// Align the window so that its last step is the current time.
+	step := c.cardinalityOptions.Step
+	n := int(c.cardinalityOptions.Lookback/step) + 1
+	end := time.Now().Truncate(time.Millisecond)
+	start := end.Add(-time.Duration(n-1) * step)
+	r, _, err := c.API.QueryRange(ctx, query, v1.Range{Start: start, End: end, Step: step})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s over %s: %w", query, c.cardinalityOptions.Lookback, err)
+	}
+	m, ok := r.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expected a matrix for %s, got: %s", query, r.Type())
+	}
+	cardinalities := map[string][]float64{}
+	for _, stream := range m {
+		name := string(stream.Metric[model.MetricNameLabel])
+		if _, ok := cardinalities[name]; !ok {
+			cardinalities[name] = make([]float64, n)
+		}
+		for _, sample := range stream.Values {
+			i := int(sample.Timestamp.Time().Sub(start).Round(time.Millisecond) / step)
+			if i >= 0 && i < n {
+				cardinalities[name][i] += float64(sample.Value)
+			}
+		}
+	}
+
+	return cardinalities, nil
+}
+
+// headMetrics returns the names of all metrics with series within the TSDB head, as reported by the TSDB status API.
+// Metrics that are absent from the head have no samples recent enough to be returned by an instant query. An error is
+// returned if the API is not served (for eg., by Thanos Querier), or if it did not report every metric within the
+// head, which is the case if their series do not add up to those within the head.
+func (c *Client) headMetrics(ctx context.Context) (sets.Set[string], error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	status, err := c.tsdbStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := sets.New[string]()
+	series := uint64(0)
+	for _, stat := range status.SeriesCountByMetricName {
+		metrics.Insert(stat.Name)
+		series += stat.Value
+	}
+	if series != uint64(status.HeadStats.NumSeries) {
+		return nil, fmt.Errorf("TSDB status reported %d out of %d series within the head", series, status.HeadStats.NumSeries)
+	}
+
+	return metrics, nil
+}
+
+// tsdbStatus returns the TSDB status, with up to tsdbStatusLimit metric names, which the API does not allow to request.
+// Clients for an existing API, that have no HTTP client of their own, are limited to the API's default.
+func (c *Client) tsdbStatus(ctx context.Context) (*v1.TSDBResult, error) {
+	if c.httpClient == nil {
+		status, err := c.API.TSDB(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get TSDB status: %w", err)
+		}
+
+		return &status, nil
+	}
+	statusURL, err := url.JoinPath(c.address, "/api/v1/status/tsdb")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse address %s: %w", c.address, err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL+"?limit="+strconv.Itoa(tsdbStatusLimit), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response from %s: %w", statusURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get TSDB status from %s: %s", statusURL, response.Status)
+	}
+	var status struct {
+		Data v1.TSDBResult `json:"data"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode TSDB status: %w", err)
+	}
+
+	return &status.Data, nil
+}
+
+// scrapeSeries are the series that Prometheus generates for every scrape, which are not exposed by the target, and are
+// not subject to metric relabeling.
+var scrapeSeries = sets.New(
+	"up",
+	"scrape_body_size_bytes",
+	"scrape_duration_seconds",
+	"scrape_sample_limit",
+	"scrape_samples_post_metric_relabeling",
+	"scrape_samples_scraped",
+	"scrape_series_added",
+	"scrape_timeout_seconds",
+)
+
+// TargetCardinality is the number of series of every metric exposed by a target, along with the number of samples
+// ingested per scrape of it, or the error encountered while evaluating them.
+type TargetCardinality struct {
+	Target           model.LabelSet
+	Metrics          map[string]uint
+	SamplesPerScrape float64
+	Err              error
+}
+
+// EvaluateTargetCardinalities evaluates the number of series of every metric exposed by each target, identified by its
+// job and instance labels, through a pool of workers. The returned cardinalities are in the same order as the targets.
+func (c *Client) EvaluateTargetCardinalities(ctx context.Context, targets []model.LabelSet) []TargetCardinality {
+	cardinalities := make([]TargetCardinality, len(targets))
+	c.parallelize(len(targets), func(limiter *rate.Limiter, i int) {
+		cardinalities[i].Target = targets[i]
+		cardinalities[i].Err = c.withRetries(ctx, limiter, func(ctx context.Context) error {
+			var err error
+			cardinalities[i].Metrics, cardinalities[i].SamplesPerScrape, err = c.getCardinalityForTarget(ctx, targets[i])
+
+			return err
+		})
+	})
+
+	return cardinalities
+}
+
+// getCardinalityForTarget returns the number of series of every metric exposed by the target, grouped by metric name
+// (leaving out the ones generated for every scrape), along with the number of samples that were left after metric relabeling in its last scrape.
+func (c *Client) getCardinalityForTarget(ctx context.Context, target model.LabelSet) (map[string]uint, float64, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	selector := &parser.VectorSelector{LabelMatchers: []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, model.JobLabel, string(target[model.JobLabel])),
+		labels.MustNewMatcher(labels.MatchEqual, model.InstanceLabel, string(target[model.InstanceLabel])),
+	}}
+	query := (&parser.AggregateExpr{
+		Op:       parser.COUNT,
+		Expr:     selector,
+		Grouping: []string{model.MetricNameLabel},
+	}).String()
+	r, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query %s: %w", query, err)
+	}
+	v, ok := r.(model.Vector)
+	if !ok {
+		return nil, 0, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+	}
+	cardinalities := map[string]uint{}
+	for _, sample := range v {
+		name := string(sample.Metric[model.MetricNameLabel])
+		if !scrapeSeries.Has(name) {
+			cardinalities[name] += uint(sample.Value)
+		}
+	}
+
+	selector.LabelMatchers = append(selector.LabelMatchers,
+		labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, "scrape_samples_post_metric_relabeling"),
+	)
+	query = selector.String()
+	r, _, err = c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query %s: %w", query, err)
+	}
+	v, ok = r.(model.Vector)
+	if !ok {
+		return nil, 0, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+	}
+	samples := 0.0
+	for _, sample := range v {
+		samples += float64(sample.Value)
+	}
+
+	return cardinalities, samples, nil
+}
+
+// LabelCardinality is the number of distinct values of every label of a metric, or the error encountered while
+// evaluating them.
+type LabelCardinality struct {
+	Metric string
+	Labels map[string]uint
+	Err    error
+}
+
+// EvaluateLabelCardinalities evaluates the number of distinct values of every label of each metric, through a pool of
+// workers. The returned cardinalities are in the same order as the metrics.
+func (c *Client) EvaluateLabelCardinalities(ctx context.Context, metrics []string) []LabelCardinality {
+	cardinalities := make([]LabelCardinality, len(metrics))
+	c.parallelize(len(metrics), func(limiter *rate.Limiter, i int) {
+		cardinalities[i].Metric = metrics[i]
+		cardinalities[i].Err = c.withRetries(ctx, limiter, func(ctx context.Context) error {
+			var err error
+			cardinalities[i].Labels, err = c.getLabelCardinalityForMetric(ctx, metrics[i])
+
+			return err
+		})
+	})
+
+	return cardinalities
+}
+
+// getLabelCardinalityForMetric returns the number of distinct values of every label of the metric, as of the series
+// that an instant query returns.
+func (c *Client) getLabelCardinalityForMetric(ctx context.Context, metric string) (map[string]uint, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	selector := &parser.VectorSelector{Name: metric, LabelMatchers: []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, metric),
+	}}
+	end := time.Now()
+	names, _, err := c.API.LabelNames(ctx, []string{selector.String()}, end.Add(-seriesLookback), end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch label names for %s: %w", metric, err)
+	}
+	cardinalities := map[string]uint{}
+	for _, name := range names {
+		if name == model.MetricNameLabel {
+			continue
+		}
+		query := fmt.Sprintf("count(count by (%s) (%s))", name, selector)
+		r, _, err := c.API.Query(ctx, query, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", query, err)
+		}
+		v, ok := r.(model.Vector)
+		if !ok {
+			return nil, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+		}
+
+		// Labels that only the series outside the instant query carry have no values.
+		if len(v) > 0 {
+			cardinalities[name] = uint(v[0].Value)
+		}
+	}
+
+	return cardinalities, nil
+}
+
+// EvaluateLabelDropCollisions returns true for every metric, out of the ones keyed within drops, whose series would no
+// longer be unique once the respective labels are dropped, in which case Prometheus would reject the scrape. The
+// check is made through a pool of workers, and a metric that could not be checked is assumed to collide.
+func (c *Client) EvaluateLabelDropCollisions(ctx context.Context, drops map[string][]string) map[string]bool {
+	metrics := make([]string, 0, len(drops))
+	for metric := range drops {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	collisions := make([]bool, len(metrics))
+	c.parallelize(len(metrics), func(limiter *rate.Limiter, i int) {
+		err := c.withRetries(ctx, limiter, func(ctx context.Context) error {
+			var err error
+			collisions[i], err = c.collidesWithout(ctx, metrics[i], drops[metrics[i]])
+
+			return err
+		})
+		if err != nil {
+			klog.V(1).Infof("assuming that dropping %v from %s collides: %v", drops[metrics[i]], metrics[i], err)
+			collisions[i] = true
+		}
+	})
+	collides := make(map[string]bool, len(metrics))
+	for i, metric := range metrics {
+		collides[metric] = collisions[i]
+	}
+
+	return collides
+}
+
+// collidesWithout returns true if the series of the metric are fewer without the labels than with them.
+func (c *Client) collidesWithout(ctx context.Context, metric string, drop []string) (bool, error) {
+	ctx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	selector := &parser.VectorSelector{Name: metric, LabelMatchers: []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, metric),
+	}}
+	query := fmt.Sprintf("count(%[1]s) - count(count without (%[2]s) (%[1]s))", selector, strings.Join(drop, ", "))
+	r, _, err := c.API.Query(ctx, query, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to query %s: %w", query, err)
+	}
+	v, ok := r.(model.Vector)
+	if !ok {
+		return false, fmt.Errorf("expected a vector for %s, got: %s", query, r.Type())
+	}
+
+	return len(v) > 0 && v[0].Value > 0, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBatchMetrics(t *testing.T) {
+	t.Parallel()
+
+	var metrics []string
+	for i := 0; i < 500; i++ {
+		metrics = append(metrics, strings.Repeat("a", i%40)+"_metric.total")
+	}
+	batches := batchMetrics(metrics)
+	if len(batches) < 2 {
+		t.Fatalf("expected the metrics to be split into several batches, got %d", len(batches))
+	}
+	var got []string
+	for _, batch := range batches {
+		quoted := make([]string, 0, len(batch))
+		for _, m := range batch {
+			quoted = append(quoted, regexp.QuoteMeta(m))
+		}
+		if regex := strings.Join(quoted, "|"); len(regex) > maxBatchRegexLength {
+			t.Errorf("expected the batch regex to be at most %d long, got %d", maxBatchRegexLength, len(regex))
+		}
+		got = append(got, batch...)
+	}
+	if !reflect.DeepEqual(got, metrics) {
+		t.Error("expected the batches to have all metrics, in order")
+	}
+
+	// A metric longer than the limit still gets a batch of its own.
+	long := strings.Repeat("b", maxBatchRegexLength+1)
+	if got := batchMetrics([]string{"up", long, "up"}); len(got) != 3 {
+		t.Errorf("expected 3 batches, got %d", len(got))
+	}
+	if got := batchMetrics(nil); len(got) != 0 {
+		t.Errorf("expected no batches, got %v", got)
+	}
+}
+
+func TestToCardinalValue(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		steps []float64
+		want  CardinalValue
+	}{
+		{
+			name:  "no series",
+			steps: nil,
+			want:  CardinalValue{Metric: "up", Range: &CardinalityRange{}},
+		},
+		{
+			name:  "single step",
+			steps: []float64{4},
+			want:  CardinalValue{Metric: "up", Value: 4, Range: &CardinalityRange{Min: 4, Avg: 4, Max: 4, P95: 4}},
+		},
+		{
+			// The 95th percentile of 20 steps is the 19th smallest one.
+			name:  "percentile",
+			steps: []float64{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+			want:  CardinalValue{Metric: "up", Value: 1, Range: &CardinalityRange{Min: 1, Avg: 10.5, Max: 20, P95: 19}},
+		},
+		{
+			name:  "absent now",
+			steps: []float64{3, 5, 0},
+			want:  CardinalValue{Metric: "up", Value: 0, Range: &CardinalityRange{Min: 0, Avg: 8.0 / 3, Max: 5, P95: 5}},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := toCardinalValue("up", tc.steps)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v with range %+v, got %+v with range %+v", tc.want, tc.want.Range, got, got.Range)
+			}
+			if wantAbsent := tc.name == "absent now"; got.AbsentNow() != wantAbsent {
+				t.Errorf("expected absent now: %t, got %t", wantAbsent, got.AbsentNow())
+			}
+		})
+	}
+}
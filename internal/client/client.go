@@ -4,104 +4,237 @@ package client
 import (
 	"context"
 	"fmt"
-	"sort"
-	"sync"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
-	"github.com/prometheus/prometheus/promql/parser"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
 type Client struct {
-	ctx         context.Context
-	address     string
-	bearerToken string
+	ctx        context.Context
+	address    string
+	httpConfig config.HTTPClientConfig
+	requests   RequestOptions
+	httpClient *http.Client
+
+	cardinalityOptions CardinalityOptions
+
+	// hasTargetsMetadata is true if the backend serves the targets metadata API, which is detected at Init.
+	hasTargetsMetadata bool
+
+	// roundTripper, if set, is used instead of the one built from httpConfig.
+	roundTripper http.RoundTripper
+
+	// metadata, if set, looks up the targets and the metadata of the metrics they expose, instead of the API.
+	metadata MetadataProvider
 	v1.API
 }
 
-func NewClient(ctx context.Context, address, bearerToken string) *Client {
+// TenantHeader is the header that Thanos and Cortex identify the tenant with.
+const TenantHeader = "X-Scope-OrgID"
+
+// RequestOptions are applied to every request made to the Prometheus instance.
+type RequestOptions struct {
+
+	// Headers are set on every request, for eg., the X-Scope-OrgID tenant header of Thanos or Cortex.
+	Headers map[string]string
+
+	// QueryParams are added to every request, for eg., the namespace parameter of the kube-rbac-proxy tenancy port.
+	QueryParams url.Values
+}
+
+// tenancy returns true if the requests are made on behalf of a tenant, either through the tenant header, or the query
+// parameters of a tenancy port, which only serve the query APIs to the tenant, leaving out the readiness endpoint, and
+// the ones that are not scoped to a tenant, such as the targets metadata API.
+func (r RequestOptions) tenancy() bool {
+	return len(r.QueryParams) > 0 || r.Headers[TenantHeader] != ""
+}
+
+// NewClient returns a client for the Prometheus instance at address, that connects to it as configured by httpConfig
+// (TLS, authentication, proxy), and applies the request options on every request.
+func NewClient(ctx context.Context, address string, httpConfig config.HTTPClientConfig, requests RequestOptions) *Client {
+	return &Client{
+		ctx:                ctx,
+		address:            address,
+		httpConfig:         httpConfig,
+		requests:           requests,
+		cardinalityOptions: DefaultCardinalityOptions,
+	}
+}
+
+// NewClientForAPI returns a client that queries the Prometheus instance through api, and looks up the targets and the
+// metadata of the metrics they expose through metadata, or api, if metadata is nil. Such a client needs no Init, and
+// is meant for programs that embed cpv, which already have an API for the Prometheus instance.
+func NewClientForAPI(api v1.API, metadata MetadataProvider) *Client {
 	return &Client{
-		ctx:         ctx,
-		address:     address,
-		bearerToken: bearerToken,
+		ctx:                context.Background(),
+		cardinalityOptions: DefaultCardinalityOptions,
+		hasTargetsMetadata: true,
+		metadata:           metadata,
+		API:                api,
 	}
 }
 
 func (c *Client) Init() error {
+	roundTripper := c.roundTripper
+	if roundTripper == nil {
+		err := c.httpConfig.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid HTTP client config: %w", err)
+		}
+		roundTripper, err = config.NewRoundTripperFromConfig(c.httpConfig, "cpv")
+		if err != nil {
+			return fmt.Errorf("failed to create round tripper: %w", err)
+		}
+	}
+	if len(c.requests.Headers) > 0 || len(c.requests.QueryParams) > 0 {
+		roundTripper = &requestOptionsRoundTripper{requests: c.requests, next: roundTripper}
+	}
+	roundTripper = &throttlingRoundTripper{next: roundTripper}
+	c.httpClient = &http.Client{Transport: roundTripper}
 	client, err := api.NewClient(api.Config{
 		Address:      c.address,
-		RoundTripper: config.NewAuthorizationCredentialsRoundTripper("Bearer", config.Secret(c.bearerToken), api.DefaultRoundTripper),
+		RoundTripper: roundTripper,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create Prometheus client: %w", err)
 	}
 	c.API = v1.NewAPI(client)
 
+	// Detect if the backend serves the targets metadata API, which, for eg., Thanos Querier does not.
+	c.hasTargetsMetadata, err = c.supports(c.ctx, "/api/v1/targets/metadata")
+	if err != nil {
+		return err
+	}
+	if !c.hasTargetsMetadata {
+		klog.Infof("%s does not serve the targets metadata API, falling back to the metadata and series APIs", c.address)
+	}
+
 	return nil
 }
 
-func (c *Client) Query(query string) (model.Value, v1.Warnings, error) {
+// IsReady returns nil if the Prometheus instance is ready to serve requests, as reported by its readiness endpoint,
+// which is queried with the same configuration as the rest of the API. When querying on behalf of a tenant, the
+// readiness endpoint is not served, so a trivial query is evaluated instead.
+func (c *Client) IsReady(ctx context.Context) error {
+	if c.requests.tenancy() {
+		_, _, err := c.API.Query(ctx, "vector(1)", time.Now())
+		if err != nil {
+			return fmt.Errorf("%s is not ready: %w", c.address, err)
+		}
 
-	//nolint:wrapcheck
-	return c.API.Query(c.ctx, query, time.Now())
+		return nil
+	}
+	readyURL, err := url.JoinPath(c.address, "/-/ready")
+	if err != nil {
+		return fmt.Errorf("failed to parse address %s: %w", c.address, err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, readyURL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to get response from %s: %w", readyURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s is not ready: %s", c.address, response.Status)
+	}
+
+	return nil
 }
 
-func (c *Client) getCardinalityForMetric(metric *parser.VectorSelector) uint {
-	query := fmt.Sprintf("count(%s)", metric)
-	r, _, err := c.Query(query)
-	if err != nil {
-		return uint(0)
+// requestOptionsRoundTripper applies the request options on every request, before passing it on to the next round
+// tripper.
+type requestOptionsRoundTripper struct {
+	requests RequestOptions
+	next     http.RoundTripper
+}
+
+func (rt *requestOptionsRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	for name, value := range rt.requests.Headers {
+		request.Header.Set(name, value)
 	}
-	v, ok := r.(model.Vector)
-	if !ok {
-		return uint(0)
+	if len(rt.requests.QueryParams) > 0 {
+		query := request.URL.Query()
+		for name, values := range rt.requests.QueryParams {
+			query[name] = values
+		}
+		request.URL.RawQuery = query.Encode()
 	}
-	cardinality := uint(0)
-	for _, sample := range v {
-		cardinality += uint(sample.Value)
+
+	//nolint:wrapcheck
+	return rt.next.RoundTrip(request)
+}
+
+// ThrottledError is returned for requests that the Prometheus instance, or any proxy in between, throttled (429).
+type ThrottledError struct {
+	Status string
+
+	// RetryAfter is the time to wait before retrying the request, as set by the Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("throttled: %s, retry after %s", e.Status, e.RetryAfter)
 	}
 
-	return cardinality
+	return "throttled: " + e.Status
 }
 
-type CardinalValue struct {
-	Metric string
-	Value  uint
+// throttlingRoundTripper turns throttled responses into a ThrottledError, since the API only reports them as generic
+// client errors, leaving out their status and Retry-After header.
+type throttlingRoundTripper struct {
+	next http.RoundTripper
 }
 
-func (c *Client) EvaluateCardinalities(ctx context.Context, metricSet *sets.Set[string]) []CardinalValue {
-	cardinalChan := make(chan CardinalValue, len(*metricSet))
-	var cardinalities []CardinalValue
-	var wg sync.WaitGroup
-	wg.Add(len(*metricSet))
-	for m := range *metricSet {
-		go func(m string) {
-			if ctx.Err() != nil {
-				klog.Warningf("context cancelled, skipping metric %s", m)
-
-				return
-			}
-			cardinalChan <- CardinalValue{
-				Metric: m,
-				Value:  c.getCardinalityForMetric(&parser.VectorSelector{Name: m}),
-			}
-			wg.Done()
-		}(m)
-	}
-	wg.Wait()
-	close(cardinalChan)
-
-	for c := range cardinalChan {
-		cardinalities = append(cardinalities, c)
-	}
-	sort.Slice(cardinalities, func(i, j int) bool {
-		return cardinalities[i].Value > cardinalities[j].Value
-	})
+func (rt *throttlingRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := rt.next.RoundTrip(request)
+	if err != nil || response.StatusCode != http.StatusTooManyRequests {
+
+		//nolint:wrapcheck
+		return response, err
+	}
+	defer response.Body.Close()
+
+	return nil, &ThrottledError{
+		Status:     response.Status,
+		RetryAfter: retryAfter(response.Header.Get("Retry-After"), time.Now()),
+	}
+}
 
-	return cardinalities
+// retryAfter returns the time to wait as set by a Retry-After header, either in seconds, or as an HTTP date, relative
+// to now. It returns zero if the header is not set, or is invalid.
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(header)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+func (c *Client) Query(query string) (model.Value, v1.Warnings, error) {
+
+	//nolint:wrapcheck
+	return c.API.Query(c.ctx, query, time.Now())
 }
@@ -4,9 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/common/config"
 	"github.com/prometheus/prometheus/promql/parser"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
@@ -38,11 +43,15 @@ func TestGetCardinalityForMetric(t *testing.T) {
 	metric := &parser.VectorSelector{
 		Name: "up",
 	}
-	c := NewClient(context.Background(), address, "")
+	c := NewClient(context.Background(), address, config.DefaultHTTPClientConfig, RequestOptions{})
 	if err := c.Init(); err != nil {
 		t.Fatal(err)
 	}
-	if k := c.getCardinalityForMetric(metric); k == 0 {
+	k, err := c.getCardinalityForMetric(context.Background(), metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k == 0 {
 		t.Logf("Got no cardinality for %s", metric)
 		t.Fail()
 	} else {
@@ -65,7 +74,7 @@ func TestEvaluateCardinalities(t *testing.T) {
 	metricSet.Insert("kubelet_node_name")
 	metricSet.Insert("up")
 
-	c := NewClient(context.Background(), address, "")
+	c := NewClient(context.Background(), address, config.DefaultHTTPClientConfig, RequestOptions{})
 	if err := c.Init(); err != nil {
 		t.Fatal(err)
 	}
@@ -75,6 +84,128 @@ func TestEvaluateCardinalities(t *testing.T) {
 		t.Fail()
 	}
 	for _, c := range cardinalities {
+		if c.Err != nil {
+			t.Errorf("%s: %v", c.Metric, c.Err)
+		}
 		t.Logf("%s: %d", c.Metric, c.Value)
 	}
 }
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "3", want: 3 * time.Second},
+		{header: "-1", want: 0},
+		{header: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{header: "soon", want: 0},
+	} {
+		if got := retryAfter(tc.header, now); got != tc.want {
+			t.Errorf("expected %s for %q, got %s", tc.want, tc.header, got)
+		}
+	}
+}
+
+func TestEvaluateCardinalitiesThrottled(t *testing.T) {
+	t.Parallel()
+
+	var queries atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/query":
+			if queries.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"up"},"value":[0,"3"]}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(context.Background(), server.URL, config.DefaultHTTPClientConfig, RequestOptions{})
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.SetCardinalityOptions(CardinalityOptions{Parallelism: 1, Retries: 1})
+	metricSet := sets.New("up")
+	start := time.Now()
+	cardinalities := c.EvaluateCardinalities(context.Background(), &metricSet)
+	if len(cardinalities) != 1 || cardinalities[0].Err != nil || cardinalities[0].Value != 3 {
+		t.Fatalf("expected the throttled query to be retried, got %+v", cardinalities)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the retry to wait for the Retry-After header, retried after %s", elapsed)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("expected 2 queries, got %d", got)
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	t.Parallel()
+
+	// The tenancy port only serves the query APIs, and forbids the rest.
+	var match atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("namespace") != "openshift-etcd" {
+			http.Error(w, "missing namespace", http.StatusBadRequest)
+
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/query":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{},"value":[0,"1"]}]}}`))
+		case "/api/v1/series":
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+			match.Store(r.Form.Get("match[]"))
+			_, _ = w.Write([]byte(`{"status":"success","data":[` +
+				`{"__name__":"etcd_server_has_leader","job":"etcd","instance":"a","namespace":"openshift-etcd"}]}`))
+		case "/api/v1/metadata":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"etcd_server_has_leader":[{"type":"gauge","help":"","unit":""}]}}`))
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(context.Background(), server.URL, config.DefaultHTTPClientConfig, RequestOptions{
+		QueryParams: url.Values{"namespace": []string{"openshift-etcd"}},
+	})
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if c.hasTargetsMetadata {
+		t.Error("expected the forbidden targets metadata API to be detected as unsupported")
+	}
+	if err := c.IsReady(context.Background()); err != nil {
+		t.Errorf("expected the tenancy port to be ready, got %v", err)
+	}
+	metadata, err := c.TargetsMetadata(context.Background(), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata[0].Metric != "etcd_server_has_leader" {
+		t.Errorf("expected the metrics of the tenant, got %+v", metadata)
+	}
+	if got, want := match.Load(), `{namespace="openshift-etcd"}`; got != want {
+		t.Errorf("expected the series to be scoped to the tenant's namespace as %s, got %v", want, got)
+	}
+}
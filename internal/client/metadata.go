@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// seriesLookback is how far back the series API is queried for the metrics exposed by a target, when falling back from
+// the targets metadata API.
+const seriesLookback = 5 * time.Minute
+
+// namespaceParam is the query parameter, and the label, that the kube-rbac-proxy tenancy port scopes the tenant with.
+const namespaceParam = "namespace"
+
+// MetadataProvider looks up the targets discovered by the Prometheus instance, and the metadata of the metrics they
+// expose. v1.API satisfies this interface.
+type MetadataProvider interface {
+	Targets(ctx context.Context) (v1.TargetsResult, error)
+	TargetsMetadata(ctx context.Context, matchTarget, metric, limit string) ([]v1.MetricMetadata, error)
+}
+
+// Targets returns the targets discovered by the Prometheus instance.
+func (c *Client) Targets(ctx context.Context) (v1.TargetsResult, error) {
+	if c.metadata != nil {
+
+		//nolint:wrapcheck
+		return c.metadata.Targets(ctx)
+	}
+
+	//nolint:wrapcheck
+	return c.API.Targets(ctx)
+}
+
+// supports returns true if the backend serves the API at path, i.e., does not respond with a 404, or, as the tenancy
+// ports of kube-rbac-proxy do for the APIs they do not proxy, with a 401 or a 403.
+func (c *Client) supports(ctx context.Context, path string) (bool, error) {
+	apiURL, err := url.JoinPath(c.address, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse address %s: %w", c.address, err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"?limit=1", http.NoBody)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect if %s is served: %w", apiURL, err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// TargetsMetadata returns the metadata of the metrics exposed by the targets matching matchTarget. If the backend does
+// not serve the targets metadata API, the metrics are looked up through the series API instead, and their metadata
+// through the metadata API, in which case the targets are only identified by the equality matchers in matchTarget, and
+// the job and instance labels of the series.
+func (c *Client) TargetsMetadata(ctx context.Context, matchTarget, metric, limit string) ([]v1.MetricMetadata, error) {
+	if c.metadata != nil {
+
+		//nolint:wrapcheck
+		return c.metadata.TargetsMetadata(ctx, matchTarget, metric, limit)
+	}
+	if c.hasTargetsMetadata {
+
+		//nolint:wrapcheck
+		return c.API.TargetsMetadata(ctx, matchTarget, metric, limit)
+	}
+
+	var matchers []*labels.Matcher
+	if matchTarget != "" {
+		var err error
+		matchers, err = parser.ParseMetricSelector(matchTarget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse target matcher %s: %w", matchTarget, err)
+		}
+	}
+	if metric != "" {
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, metric))
+	}
+	if len(matchers) == 0 {
+		matchers = []*labels.Matcher{c.allTargetsMatcher(ctx)}
+	}
+	match := (&parser.VectorSelector{LabelMatchers: matchers}).String()
+
+	end := time.Now()
+	series, _, err := c.API.Series(ctx, []string{match}, end.Add(-seriesLookback), end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch series for %s: %w", match, err)
+	}
+	metadata, err := c.API.Metadata(ctx, metric, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+
+	// Only scraped metrics have metadata, which leaves out the ones recorded by rules. The metrics are reported per
+	// target, identified by the equality matchers in matchTarget, along with the job and instance of their series.
+	target := model.LabelSet{}
+	for _, matcher := range matchers {
+		if matcher.Type == labels.MatchEqual && matcher.Name != model.MetricNameLabel {
+			target[model.LabelName(matcher.Name)] = model.LabelValue(matcher.Value)
+		}
+	}
+	targets := map[string]model.LabelSet{}
+	targetMetrics := map[string]sets.Set[string]{}
+	for _, s := range series {
+		family, ok := metricFamily(string(s[model.MetricNameLabel]), metadata)
+		if !ok {
+			continue
+		}
+		seriesTarget := target.Clone()
+		for _, name := range []model.LabelName{model.JobLabel, model.InstanceLabel} {
+			if value, ok := s[name]; ok {
+				seriesTarget[name] = value
+			}
+		}
+		key := seriesTarget.String()
+		if _, ok := targets[key]; !ok {
+			targets[key] = seriesTarget
+			targetMetrics[key] = sets.Set[string]{}
+		}
+		targetMetrics[key].Insert(family)
+	}
+
+	maxResults := 0
+	if limit != "" {
+		maxResults, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse limit %s: %w", limit, err)
+		}
+	}
+	var targetsMetadata []v1.MetricMetadata
+	for _, key := range sets.List(sets.KeySet(targets)) {
+		t := map[string]string{}
+		for name, value := range targets[key] {
+			t[string(name)] = string(value)
+		}
+		for _, m := range sets.List(targetMetrics[key]) {
+			mm := metadata[m]
+			targetsMetadata = append(targetsMetadata, v1.MetricMetadata{
+				Target: t,
+				Metric: m,
+				Type:   mm[0].Type,
+				Help:   mm[0].Help,
+				Unit:   mm[0].Unit,
+			})
+			if maxResults > 0 && len(targetsMetadata) == maxResults {
+				return targetsMetadata, nil
+			}
+		}
+	}
+
+	return targetsMetadata, nil
+}
+
+// allTargetsMatcher returns the matcher that scopes the series looked up for the metrics exposed by all targets, i.e.,
+// the namespace of the tenant, if set as a query parameter, or else the jobs of the discovered targets, so that not
+// every series is looked up. It matches every series only if neither is known.
+func (c *Client) allTargetsMatcher(ctx context.Context) *labels.Matcher {
+	if namespace := c.requests.QueryParams.Get(namespaceParam); namespace != "" {
+		return labels.MustNewMatcher(labels.MatchEqual, namespaceParam, namespace)
+	}
+	targets, err := c.API.Targets(ctx)
+	if err != nil {
+		klog.V(1).Infof("failed to fetch targets, looking up all series: %v", err)
+	}
+	jobs := sets.Set[string]{}
+	for _, target := range targets.Active {
+		if job := target.Labels[model.JobLabel]; job != "" {
+			jobs.Insert(regexp.QuoteMeta(string(job)))
+		}
+	}
+	if jobs.Len() == 0 {
+		return labels.MustNewMatcher(labels.MatchRegexp, model.MetricNameLabel, ".+")
+	}
+
+	return labels.MustNewMatcher(labels.MatchRegexp, model.JobLabel, strings.Join(sets.List(jobs), "|"))
+}
+
+// metricFamily returns the name of the metric family that the series name belongs to, as keyed within the metadata,
+// for eg., the histogram foo for the series foo_bucket, in the same way the targets metadata API reports it.
+func metricFamily(name string, metadata map[string][]v1.Metadata) (string, bool) {
+	if len(metadata[name]) > 0 {
+		return name, true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total", "_created"} {
+		family := strings.TrimSuffix(name, suffix)
+		if family != name && len(metadata[family]) > 0 {
+			return family, true
+		}
+	}
+
+	return "", false
+}
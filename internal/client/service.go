@@ -0,0 +1,226 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// ServiceMode is how a Prometheus service within the cluster is reached.
+type ServiceMode string
+
+const (
+	// ServiceModeProxy reaches the service through the API server's service proxy.
+	ServiceModeProxy ServiceMode = "proxy"
+
+	// ServiceModePortForward reaches a pod backing the service through an in-process port-forward.
+	ServiceModePortForward ServiceMode = "port-forward"
+)
+
+// Service is a Prometheus service within the cluster.
+type Service struct {
+	Namespace string
+	Scheme    string
+	Name      string
+	Port      string
+}
+
+// ParseService parses the service, specified as <namespace>/[<scheme>:]<name>:<port>, where the port may either be
+// the name or the number of the service port, and the scheme defaults to http.
+func ParseService(s string) (Service, error) {
+	namespace, remainder, found := strings.Cut(s, "/")
+	if !found || namespace == "" {
+		return Service{}, fmt.Errorf("expected the service as <namespace>/[<scheme>:]<name>:<port>, got: %s", s)
+	}
+	parts := strings.Split(remainder, ":")
+	service := Service{Namespace: namespace, Scheme: "http"}
+	switch len(parts) {
+	case 2:
+		service.Name, service.Port = parts[0], parts[1]
+	case 3:
+		service.Scheme, service.Name, service.Port = parts[0], parts[1], parts[2]
+	default:
+		return Service{}, fmt.Errorf("expected the service as <namespace>/[<scheme>:]<name>:<port>, got: %s", s)
+	}
+	if service.Name == "" || service.Port == "" {
+		return Service{}, fmt.Errorf("expected the service as <namespace>/[<scheme>:]<name>:<port>, got: %s", s)
+	}
+	if service.Scheme != "http" && service.Scheme != "https" {
+		return Service{}, fmt.Errorf("unsupported scheme %s, expected http or https", service.Scheme)
+	}
+
+	return service, nil
+}
+
+// String returns the service as <namespace>/<scheme>:<name>:<port>.
+func (s Service) String() string {
+	return fmt.Sprintf("%s/%s:%s:%s", s.Namespace, s.Scheme, s.Name, s.Port)
+}
+
+// NewServiceProxyClient returns a client for the Prometheus service, that reaches it through the API server's service
+// proxy, authenticating against the API server with the credentials within restConfig.
+func NewServiceProxyClient(ctx context.Context, restConfig *rest.Config, service Service, requests RequestOptions) (*Client, error) {
+	roundTripper, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for the API server: %w", err)
+	}
+	address := strings.TrimSuffix(restConfig.Host, "/") + fmt.Sprintf(
+		"/api/v1/namespaces/%s/services/%s:%s:%s/proxy",
+		service.Namespace, service.Scheme, service.Name, service.Port,
+	)
+	c := &Client{
+		ctx:                ctx,
+		address:            address,
+		requests:           requests,
+		roundTripper:       roundTripper,
+		cardinalityOptions: DefaultCardinalityOptions,
+	}
+
+	return c, nil
+}
+
+// PortForward forwards a local port to a running pod backing the Prometheus service, and returns the local address
+// along with a function that stops forwarding. Forwarding also stops once ctx is done.
+func PortForward(ctx context.Context, restConfig *rest.Config, service Service) (string, func(), error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create Kube client: %w", err)
+	}
+	pod, targetPort, err := resolveServicePod(ctx, clientset, service)
+	if err != nil {
+		return "", nil, err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create SPDY round tripper: %w", err)
+	}
+	portForwardURL := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.GetNamespace()).
+		Name(pod.GetName()).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, portForwardURL)
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(
+		dialer,
+		[]string{"localhost"},
+		[]string{fmt.Sprintf("0:%d", targetPort)},
+		stopCh,
+		readyCh,
+		io.Discard,
+		io.Discard,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create port-forward: %w", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- forwarder.ForwardPorts()
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(stopCh)
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return "", nil, fmt.Errorf("failed to port-forward to %s/%s: %w", pod.GetNamespace(), pod.GetName(), err)
+	case <-ctx.Done():
+		stop()
+
+		return "", nil, fmt.Errorf("failed to port-forward to %s/%s: %w", pod.GetNamespace(), pod.GetName(), ctx.Err())
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		stop()
+
+		return "", nil, fmt.Errorf("failed to get forwarded ports: %w", err)
+	}
+
+	return fmt.Sprintf("%s://localhost:%d", service.Scheme, ports[0].Local), stop, nil
+}
+
+// resolveServicePod returns a running pod backing the service, along with the container port that the service port
+// targets.
+func resolveServicePod(ctx context.Context, clientset kubernetes.Interface, service Service) (*corev1.Pod, int, error) {
+	svc, err := clientset.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get service %s/%s: %w", service.Namespace, service.Name, err)
+	}
+	var servicePort *corev1.ServicePort
+	for i, port := range svc.Spec.Ports {
+		if port.Name == service.Port || strconv.Itoa(int(port.Port)) == service.Port {
+			servicePort = &svc.Spec.Ports[i]
+
+			break
+		}
+	}
+	if servicePort == nil {
+		return nil, 0, fmt.Errorf("port %s not found within service %s/%s", service.Port, service.Namespace, service.Name)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return nil, 0, fmt.Errorf("service %s/%s has no selector to find its pods with", service.Namespace, service.Name)
+	}
+	pods, err := clientset.CoreV1().Pods(service.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list pods for service %s/%s: %w", service.Namespace, service.Name, err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+		targetPort, found := containerPort(pod, servicePort.TargetPort, servicePort.Port)
+		if found {
+			return pod, targetPort, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("no running pods found for service %s/%s", service.Namespace, service.Name)
+}
+
+// containerPort resolves the target port of a service port against the containers of the pod. A target port that is
+// left out defaults to the service port.
+func containerPort(pod *corev1.Pod, targetPort intstr.IntOrString, port int32) (int, bool) {
+	switch {
+	case targetPort.Type == intstr.Int && targetPort.IntVal != 0:
+		return targetPort.IntValue(), true
+	case targetPort.Type == intstr.String && targetPort.StrVal != "":
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == targetPort.StrVal {
+					return int(containerPort.ContainerPort), true
+				}
+			}
+		}
+
+		return 0, false
+	}
+
+	return int(port), true
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestParseService(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		service string
+		want    Service
+		wantErr bool
+	}{
+		{
+			service: "openshift-monitoring/prometheus-k8s:9091",
+			want:    Service{Namespace: "openshift-monitoring", Scheme: "http", Name: "prometheus-k8s", Port: "9091"},
+		},
+		{
+			service: "openshift-monitoring/https:prometheus-k8s:web",
+			want:    Service{Namespace: "openshift-monitoring", Scheme: "https", Name: "prometheus-k8s", Port: "web"},
+		},
+		{service: "prometheus-k8s:9091", wantErr: true},
+		{service: "/prometheus-k8s:9091", wantErr: true},
+		{service: "openshift-monitoring/prometheus-k8s", wantErr: true},
+		{service: "openshift-monitoring/prometheus-k8s:", wantErr: true},
+		{service: "openshift-monitoring/grpc:prometheus-k8s:9091", wantErr: true},
+		{service: "openshift-monitoring/https:prometheus-k8s:web:9091", wantErr: true},
+	} {
+		tc := tc
+		t.Run(tc.service, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseService(tc.service)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			// The formatted service always has its scheme, and parses back to itself.
+			reparsed, err := ParseService(got.String())
+			if err != nil || reparsed != got {
+				t.Errorf("expected %s to parse back to %+v, got %+v: %v", got, got, reparsed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package fake
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// listKinds are the list kinds of the resources that cpv lists.
+var listKinds = map[schema.GroupVersionResource]string{
+	{Group: monitoring.GroupName, Version: monitoringv1.Version, Resource: monitoringv1.ServiceMonitorName}: monitoringv1.ServiceMonitorsKind + "List",
+	{Group: monitoring.GroupName, Version: monitoringv1.Version, Resource: monitoringv1.PodMonitorName}:     monitoringv1.PodMonitorsKind + "List",
+	{Group: monitoring.GroupName, Version: monitoringv1.Version, Resource: monitoringv1.PrometheusRuleName}: monitoringv1.PrometheusRuleKind + "List",
+	{Version: "v1", Resource: "configmaps"}: "ConfigMapList",
+}
+
+// NewDynamicClient returns a fake dynamic client, populated with the objects within the manifests at paths, for eg.,
+// the ServiceMonitors, PodMonitors, PrometheusRules and ConfigMaps that cpv lists. Every manifest may contain multiple
+// documents.
+func NewDynamicClient(t testing.TB, paths ...string) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+
+	var objects []runtime.Object
+	for _, path := range paths {
+		f, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			t.Fatalf("failed to open manifest: %v", err)
+		}
+		decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			object := map[string]interface{}{}
+			err = decoder.Decode(&object)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to decode %s: %v", path, err)
+			}
+			if len(object) > 0 {
+				objects = append(objects, &unstructured.Unstructured{Object: object})
+			}
+		}
+		_ = f.Close()
+	}
+
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
@@ -0,0 +1,513 @@
+// Package fake contains in-process fakes of the Prometheus HTTP API and the Kubernetes API, backed by fixtures, so that
+// tests run offline.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// PrometheusFixture is the state of a fake Prometheus instance.
+type PrometheusFixture struct {
+
+	// Time is the time at which all queries are evaluated, as a duration since the epoch, where the loaded series start.
+	Time model.Duration `yaml:"time"`
+
+	// Series are the series within the TSDB, as load commands of the PromQL test language, for eg.,
+	// `load 1m\n  foo{job="bar"} 0+1x10`.
+	Series string `yaml:"series"`
+
+	// Targets are the targets discovered by the Prometheus instance.
+	Targets []Target `yaml:"targets"`
+
+	// RuleFiles are the rule files loaded by the Prometheus instance, relative to the fixture.
+	RuleFiles []string `yaml:"ruleFiles"`
+}
+
+// Target is a target discovered by the Prometheus instance, along with the metadata of the metrics it exposes.
+type Target struct {
+	ScrapePool string            `yaml:"scrapePool"`
+	Labels     map[string]string `yaml:"labels"`
+	Metadata   []Metadata        `yaml:"metadata"`
+}
+
+// Metadata is the metadata of a metric exposed by a target.
+type Metadata struct {
+	Metric string        `yaml:"metric"`
+	Type   v1.MetricType `yaml:"type"`
+	Help   string        `yaml:"help"`
+	Unit   string        `yaml:"unit"`
+}
+
+// Prometheus is a fake Prometheus instance, that serves the parts of the HTTP API that cpv uses from a fixture. Queries
+// are evaluated by the PromQL engine against the fixture's series, at the fixture's time, regardless of the time they
+// were requested at, and range queries are shifted to end at it.
+type Prometheus struct {
+	*httptest.Server
+	fixture *PrometheusFixture
+	groups  []ruleGroup
+	storage *teststorage.TestStorage
+	engine  *promql.Engine
+	now     time.Time
+
+	// withoutTargetsMetadata is true if the targets metadata API is not served.
+	withoutTargetsMetadata bool
+}
+
+// PrometheusOption configures the fake Prometheus instance.
+type PrometheusOption func(*Prometheus)
+
+// WithoutTargetsMetadata does not serve the targets metadata API, as is the case with Thanos Querier.
+func WithoutTargetsMetadata() PrometheusOption {
+	return func(p *Prometheus) {
+		p.withoutTargetsMetadata = true
+	}
+}
+
+// NewPrometheus starts a fake Prometheus instance from the fixture at path, which is stopped once the test is done.
+func NewPrometheus(t testing.TB, path string, options ...PrometheusOption) *Prometheus {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	fixture := &PrometheusFixture{}
+	err = yaml.Unmarshal(b, fixture)
+	if err != nil {
+		t.Fatalf("failed to parse fixture %s: %v", path, err)
+	}
+	p := &Prometheus{
+		fixture: fixture,
+		storage: promql.LoadedStorage(t, fixture.Series),
+		engine: promql.NewEngine(promql.EngineOpts{
+			MaxSamples: 1e6,
+			Timeout:    time.Minute,
+		}),
+		now: time.Unix(0, 0).Add(time.Duration(fixture.Time)).UTC(),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	for _, ruleFile := range fixture.RuleFiles {
+		ruleGroups, errs := rulefmt.ParseFile(filepath.Join(filepath.Dir(path), ruleFile))
+		if len(errs) > 0 {
+			t.Fatalf("failed to parse rule file %s: %v", ruleFile, errs)
+		}
+		for _, group := range ruleGroups.Groups {
+			p.groups = append(p.groups, ruleGroup{RuleGroup: group, file: ruleFile})
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/ready", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/v1/query", p.handle(p.query))
+	mux.HandleFunc("/api/v1/query_range", p.handle(p.queryRange))
+	mux.HandleFunc("/api/v1/series", p.handle(p.series))
+	mux.HandleFunc("/api/v1/labels", p.handle(p.labelNames))
+	mux.HandleFunc("/api/v1/label/", p.handle(p.labelValues))
+	mux.HandleFunc("/api/v1/targets", p.handle(p.targets))
+	if !p.withoutTargetsMetadata {
+		mux.HandleFunc("/api/v1/targets/metadata", p.handle(p.targetsMetadata))
+	}
+	mux.HandleFunc("/api/v1/metadata", p.handle(p.metadata))
+	mux.HandleFunc("/api/v1/rules", p.handle(p.rules))
+	mux.HandleFunc("/api/v1/status/tsdb", p.handle(p.tsdbStatus))
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		p.Server.Close()
+		_ = p.storage.Close()
+	})
+
+	return p
+}
+
+// ruleGroup is a rule group, along with the rule file it was loaded from.
+type ruleGroup struct {
+	rulefmt.RuleGroup
+	file string
+}
+
+// handle responds with the data returned by serve, within the envelope of the Prometheus HTTP API.
+func (p *Prometheus) handle(serve func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := r.ParseForm()
+		var data interface{}
+		if err == nil {
+			data, err = serve(r)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"status":    "error",
+				"errorType": "bad_data",
+				"error":     err.Error(),
+			})
+
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   data,
+		})
+	}
+}
+
+// queryResult is the data of the query APIs.
+type queryResult struct {
+	ResultType parser.ValueType `json:"resultType"`
+	Result     interface{}      `json:"result"`
+}
+
+func (p *Prometheus) query(r *http.Request) (interface{}, error) {
+	q, err := p.engine.NewInstantQuery(r.Context(), p.storage, nil, r.Form.Get("query"), p.now)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+	defer q.Close()
+
+	return toQueryResult(q.Exec(r.Context()))
+}
+
+func (p *Prometheus) queryRange(r *http.Request) (interface{}, error) {
+	start, err := parseTime(r.Form.Get("start"))
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(r.Form.Get("end"))
+	if err != nil {
+		return nil, err
+	}
+	step, err := strconv.ParseFloat(r.Form.Get("step"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step: %w", err)
+	}
+	q, err := p.engine.NewRangeQuery(
+		r.Context(),
+		p.storage,
+		nil,
+		r.Form.Get("query"),
+		p.now.Add(start.Sub(end)),
+		p.now,
+		time.Duration(step*float64(time.Second)),
+	)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+	defer q.Close()
+
+	return toQueryResult(q.Exec(r.Context()))
+}
+
+// toQueryResult converts the result of a query to the representation used by the query APIs.
+func toQueryResult(result *promql.Result) (interface{}, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	switch v := result.Value.(type) {
+	case promql.Vector:
+		vector := model.Vector{}
+		for _, s := range v {
+			vector = append(vector, &model.Sample{
+				Metric:    toMetric(s.Metric),
+				Value:     model.SampleValue(s.F),
+				Timestamp: model.Time(s.T),
+			})
+		}
+
+		return queryResult{ResultType: parser.ValueTypeVector, Result: vector}, nil
+	case promql.Matrix:
+		matrix := model.Matrix{}
+		for _, s := range v {
+			stream := &model.SampleStream{Metric: toMetric(s.Metric)}
+			for _, f := range s.Floats {
+				stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.Time(f.T), Value: model.SampleValue(f.F)})
+			}
+			matrix = append(matrix, stream)
+		}
+
+		return queryResult{ResultType: parser.ValueTypeMatrix, Result: matrix}, nil
+	case promql.Scalar:
+		return queryResult{
+			ResultType: parser.ValueTypeScalar,
+			Result:     &model.Scalar{Value: model.SampleValue(v.V), Timestamp: model.Time(v.T)},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %s", result.Value.Type())
+	}
+}
+
+func (p *Prometheus) series(r *http.Request) (interface{}, error) {
+	var series []model.Metric
+	err := p.selectSeries(r, func(lset labels.Labels) {
+		series = append(series, toMetric(lset))
+	})
+
+	return series, err
+}
+
+func (p *Prometheus) labelNames(r *http.Request) (interface{}, error) {
+	names := sets.Set[string]{}
+	err := p.selectSeries(r, func(lset labels.Labels) {
+		lset.Range(func(l labels.Label) {
+			names.Insert(l.Name)
+		})
+	})
+
+	return sets.List(names), err
+}
+
+func (p *Prometheus) labelValues(r *http.Request) (interface{}, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/label/"), "/values")
+	values := sets.Set[string]{}
+	err := p.selectSeries(r, func(lset labels.Labels) {
+		if value := lset.Get(name); value != "" {
+			values.Insert(value)
+		}
+	})
+
+	return sets.List(values), err
+}
+
+// selectSeries calls f with the label set of every series that matches any of the match[] selectors of the request, or
+// every series, if none are given.
+func (p *Prometheus) selectSeries(r *http.Request, f func(labels.Labels)) error {
+	selectors := r.Form["match[]"]
+	if len(selectors) == 0 {
+		selectors = []string{`{__name__=~".+"}`}
+	}
+	querier, err := p.storage.Querier(context.Background(), 0, p.now.UnixMilli())
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	defer querier.Close()
+	seen := sets.Set[uint64]{}
+	for _, selector := range selectors {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			//nolint:wrapcheck
+			return err
+		}
+		set := querier.Select(false, nil, matchers...)
+		for set.Next() {
+			lset := set.At().Labels()
+			if !seen.Has(lset.Hash()) {
+				seen.Insert(lset.Hash())
+				f(lset)
+			}
+		}
+		if set.Err() != nil {
+			//nolint:wrapcheck
+			return set.Err()
+		}
+	}
+
+	return nil
+}
+
+func (p *Prometheus) targets(_ *http.Request) (interface{}, error) {
+	result := v1.TargetsResult{Active: []v1.ActiveTarget{}, Dropped: []v1.DroppedTarget{}}
+	for _, target := range p.fixture.Targets {
+		result.Active = append(result.Active, v1.ActiveTarget{
+			ScrapePool: target.ScrapePool,
+			Labels:     toLabelSet(target.Labels),
+			Health:     v1.HealthGood,
+		})
+	}
+
+	return result, nil
+}
+
+func (p *Prometheus) targetsMetadata(r *http.Request) (interface{}, error) {
+	var matchers []*labels.Matcher
+	if matchTarget := r.Form.Get("match_target"); matchTarget != "" {
+		var err error
+		matchers, err = parser.ParseMetricSelector(matchTarget)
+		if err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+	}
+	metric := r.Form.Get("metric")
+	limit, _ := strconv.Atoi(r.Form.Get("limit"))
+	metadata := []v1.MetricMetadata{}
+	for _, target := range p.fixture.Targets {
+		if !matches(matchers, target.Labels) {
+			continue
+		}
+		for _, m := range target.Metadata {
+			if metric != "" && m.Metric != metric {
+				continue
+			}
+			metadata = append(metadata, v1.MetricMetadata{
+				Target: target.Labels,
+				Metric: m.Metric,
+				Type:   m.Type,
+				Help:   m.Help,
+				Unit:   m.Unit,
+			})
+			if limit > 0 && len(metadata) == limit {
+				return metadata, nil
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+func (p *Prometheus) metadata(r *http.Request) (interface{}, error) {
+	metric := r.Form.Get("metric")
+	metadata := map[string][]v1.Metadata{}
+	for _, target := range p.fixture.Targets {
+		for _, m := range target.Metadata {
+			if (metric != "" && m.Metric != metric) || len(metadata[m.Metric]) > 0 {
+				continue
+			}
+			metadata[m.Metric] = append(metadata[m.Metric], v1.Metadata{Type: m.Type, Help: m.Help, Unit: m.Unit})
+		}
+	}
+
+	return metadata, nil
+}
+
+func (p *Prometheus) rules(_ *http.Request) (interface{}, error) {
+	groups := []map[string]interface{}{}
+	for _, group := range p.groups {
+		rules := []map[string]interface{}{}
+		for _, rule := range group.Rules {
+			if rule.Record.Value != "" {
+				rules = append(rules, map[string]interface{}{
+					"type":   string(v1.RuleTypeRecording),
+					"name":   rule.Record.Value,
+					"query":  rule.Expr.Value,
+					"health": string(v1.RuleHealthGood),
+				})
+
+				continue
+			}
+			rules = append(rules, map[string]interface{}{
+				"type":        string(v1.RuleTypeAlerting),
+				"name":        rule.Alert.Value,
+				"query":       rule.Expr.Value,
+				"health":      string(v1.RuleHealthGood),
+				"state":       "inactive",
+				"annotations": map[string]string{},
+				"labels":      map[string]string{},
+				"alerts":      []interface{}{},
+			})
+		}
+		groups = append(groups, map[string]interface{}{
+			"name":     group.Name,
+			"file":     group.file,
+			"interval": 30,
+			"rules":    rules,
+		})
+	}
+
+	return map[string]interface{}{"groups": groups}, nil
+}
+
+func (p *Prometheus) tsdbStatus(r *http.Request) (interface{}, error) {
+	counts := map[string]uint64{}
+	var numSeries int
+	err := p.selectSeries(r, func(lset labels.Labels) {
+		counts[lset.Get(labels.MetricName)]++
+		numSeries++
+	})
+	if err != nil {
+		return nil, err
+	}
+	limit, _ := strconv.Atoi(r.Form.Get("limit"))
+	if limit == 0 {
+		limit = 10
+	}
+	seriesCountByMetricName := []v1.Stat{}
+	for name, count := range counts {
+		seriesCountByMetricName = append(seriesCountByMetricName, v1.Stat{Name: name, Value: count})
+	}
+	sort.Slice(seriesCountByMetricName, func(i, j int) bool {
+		if seriesCountByMetricName[i].Value != seriesCountByMetricName[j].Value {
+			return seriesCountByMetricName[i].Value > seriesCountByMetricName[j].Value
+		}
+
+		return seriesCountByMetricName[i].Name < seriesCountByMetricName[j].Name
+	})
+	if len(seriesCountByMetricName) > limit {
+		seriesCountByMetricName = seriesCountByMetricName[:limit]
+	}
+
+	return v1.TSDBResult{
+		HeadStats:                   v1.TSDBHeadStats{NumSeries: numSeries},
+		SeriesCountByMetricName:     seriesCountByMetricName,
+		LabelValueCountByLabelName:  []v1.Stat{},
+		MemoryInBytesByLabelName:    []v1.Stat{},
+		SeriesCountByLabelValuePair: []v1.Stat{},
+	}, nil
+}
+
+// matches returns true if the label set satisfies all matchers.
+func matches(matchers []*labels.Matcher, labelSet map[string]string) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(labelSet[matcher.Name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseTime parses the time of a query, as a Unix timestamp, or in RFC 3339.
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMilli(int64(t * 1000)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+
+	return t, nil
+}
+
+func toMetric(lset labels.Labels) model.Metric {
+	metric := model.Metric{}
+	lset.Range(func(l labels.Label) {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	})
+
+	return metric
+}
+
+func toLabelSet(m map[string]string) model.LabelSet {
+	labelSet := model.LabelSet{}
+	for name, value := range m {
+		labelSet[model.LabelName(name)] = model.LabelValue(value)
+	}
+
+	return labelSet
+}
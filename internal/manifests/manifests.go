@@ -0,0 +1,139 @@
+// Package manifests loads monitoring resources from rendered manifests on disk.
+package manifests
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestExtensions are the file extensions that are considered when walking the manifests directory.
+var manifestExtensions = map[string]struct{}{
+	".yaml": {},
+	".yml":  {},
+	".json": {},
+}
+
+// PrometheusRule is a PrometheusRule along with the path of the manifest it was loaded from.
+type PrometheusRule struct {
+	*monitoringv1.PrometheusRule
+	Path string
+}
+
+// Manifests contains all the monitoring resources found within a manifests directory.
+type Manifests struct {
+	ServiceMonitors []*monitoringv1.ServiceMonitor
+	PodMonitors     []*monitoringv1.PodMonitor
+	PrometheusRules []PrometheusRule
+}
+
+// Load walks dir recursively and collects all ServiceMonitor, PodMonitor and PrometheusRule resources within it. Files
+// may contain multiple documents, as well as List kinds, as rendered by kustomize or helm.
+func Load(dir string) (*Manifests, error) {
+	m := &Manifests{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := manifestExtensions[strings.ToLower(filepath.Ext(path))]; !ok {
+			return nil
+		}
+
+		return m.loadFile(path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifests from %s: %w", dir, err)
+	}
+
+	return m, nil
+}
+
+func (m *Manifests) loadFile(path string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		object := map[string]interface{}{}
+		err = decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+
+		// Skip empty documents.
+		if len(object) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: object}
+		if u.IsList() {
+			err = u.EachListItem(func(item runtime.Object) error {
+				itemU, ok := item.(*unstructured.Unstructured)
+				if !ok {
+					return fmt.Errorf("expected an unstructured object, got: %T", item)
+				}
+
+				return m.add(path, itemU)
+			})
+		} else {
+			err = m.add(path, u)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Manifests) add(path string, u *unstructured.Unstructured) error {
+	gvk := u.GroupVersionKind()
+	if gvk.Group != monitoring.GroupName {
+		return nil
+	}
+	var err error
+	switch gvk.Kind {
+	case monitoringv1.ServiceMonitorsKind:
+		var serviceMonitor *monitoringv1.ServiceMonitor
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &serviceMonitor)
+		if err == nil {
+			m.ServiceMonitors = append(m.ServiceMonitors, serviceMonitor)
+		}
+	case monitoringv1.PodMonitorsKind:
+		var podMonitor *monitoringv1.PodMonitor
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &podMonitor)
+		if err == nil {
+			m.PodMonitors = append(m.PodMonitors, podMonitor)
+		}
+	case monitoringv1.PrometheusRuleKind:
+		var prometheusRule *monitoringv1.PrometheusRule
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &prometheusRule)
+		if err == nil {
+			m.PrometheusRules = append(m.PrometheusRules, PrometheusRule{PrometheusRule: prometheusRule, Path: path})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert unstructured to %s: %w", strings.ToLower(gvk.Kind), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package manifests
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	m, err := Load(filepath.Join("testdata", "valid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var serviceMonitors []string
+	for _, serviceMonitor := range m.ServiceMonitors {
+		serviceMonitors = append(serviceMonitors, serviceMonitor.Namespace+"/"+serviceMonitor.Name)
+	}
+	sort.Strings(serviceMonitors)
+	want := []string{
+		"openshift-monitoring/kube-state-metrics",
+		"openshift-monitoring/node-exporter",
+		"openshift-monitoring/prometheus-k8s",
+	}
+	if len(serviceMonitors) != len(want) {
+		t.Fatalf("expected service monitors %v, got %v", want, serviceMonitors)
+	}
+	for i := range want {
+		if serviceMonitors[i] != want[i] {
+			t.Errorf("expected service monitors %v, got %v", want, serviceMonitors)
+		}
+	}
+
+	if len(m.PodMonitors) != 1 || m.PodMonitors[0].Name != "etcd" || len(m.PodMonitors[0].Spec.PodMetricsEndpoints) != 1 {
+		t.Errorf("expected the etcd pod monitor from the list, got: %+v", m.PodMonitors)
+	}
+
+	if len(m.PrometheusRules) != 1 {
+		t.Fatalf("expected 1 prometheus rule, got %d", len(m.PrometheusRules))
+	}
+	rule := m.PrometheusRules[0]
+	if rule.Name != "kube-state-metrics-rules" || rule.Path != filepath.Join("testdata", "valid", "multi-doc.yaml") {
+		t.Errorf("unexpected prometheus rule %s loaded from %s", rule.Name, rule.Path)
+	}
+	if len(rule.Spec.Groups) != 1 || len(rule.Spec.Groups[0].Rules) != 1 {
+		t.Errorf("unexpected rule groups: %+v", rule.Spec.Groups)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, dir := range []string{
+		filepath.Join("testdata", "invalid"),
+		filepath.Join("testdata", "missing"),
+	} {
+		if _, err := Load(dir); err == nil {
+			t.Errorf("expected an error loading %s", dir)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package options
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/profiles"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// Config is the declarative configuration of the command, loaded from the file at -config. Flags that are explicitly
+// set override the respective fields.
+type Config struct {
+	Prometheus PrometheusConfig   `json:"prometheus"`
+	Cluster    ClusterConfig      `json:"cluster"`
+	Profile    string             `json:"profile"`
+	Profiles   []profiles.Profile `json:"profiles"`
+	Noisy      bool               `json:"noisy"`
+	Savings    bool               `json:"savings"`
+	Extract    ExtractConfig      `json:"extract"`
+	Output     OutputConfig       `json:"output"`
+}
+
+// PrometheusConfig is the configuration of the Prometheus instance.
+type PrometheusConfig struct {
+	Address            string            `json:"address"`
+	Service            string            `json:"service"`
+	ServiceMode        string            `json:"serviceMode"`
+	BearerToken        string            `json:"bearerToken"`
+	BearerTokenFile    string            `json:"bearerTokenFile"`
+	BasicAuth          BasicAuthConfig   `json:"basicAuth"`
+	CAFile             string            `json:"caFile"`
+	CertFile           string            `json:"certFile"`
+	KeyFile            string            `json:"keyFile"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify"`
+	ProxyURL           string            `json:"proxyURL"`
+	Headers            map[string]string `json:"headers"`
+	QueryParams        map[string]string `json:"queryParams"`
+	Tenant             string            `json:"tenant"`
+}
+
+// BasicAuthConfig is the basic authentication configuration of the Prometheus instance.
+type BasicAuthConfig struct {
+	Username     string `json:"username"`
+	PasswordFile string `json:"passwordFile"`
+}
+
+// ClusterConfig is the configuration of the cluster, or the rendered manifests, to source the monitors and rules from.
+type ClusterConfig struct {
+	Kubeconfig               string `json:"kubeconfig"`
+	Context                  string `json:"context"`
+	ManifestsDir             string `json:"manifestsDir"`
+	PrometheusRules          bool   `json:"prometheusRules"`
+	PrometheusRulesNamespace string `json:"prometheusRulesNamespace"`
+	PrometheusRulesSelector  string `json:"prometheusRulesSelector"`
+}
+
+// ExtractConfig is the configuration of the sources to extract metrics from.
+type ExtractConfig struct {
+	AllowListFile      string            `json:"allowListFile"`
+	RuleFiles          []string          `json:"ruleFiles"`
+	Dashboards         []string          `json:"dashboards"`
+	TargetSelectors    string            `json:"targetSelectors"`
+	TelemetryConfig    string            `json:"telemetryConfig"`
+	TelemetryConfigMap string            `json:"telemetryConfigMap"`
+	OutputCardinality  bool              `json:"outputCardinality"`
+	LabelCardinality   bool              `json:"labelCardinality"`
+	Cardinality        CardinalityConfig `json:"cardinality"`
+}
+
+// CardinalityConfig is the configuration of how the cardinality of the extracted metrics is evaluated.
+type CardinalityConfig struct {
+	Parallelism  int            `json:"parallelism"`
+	Retries      *int           `json:"retries"`
+	QueryTimeout model.Duration `json:"queryTimeout"`
+	RateLimit    float64        `json:"rateLimit"`
+	Lookback     model.Duration `json:"lookback"`
+	Step         model.Duration `json:"step"`
+}
+
+// OutputConfig is the configuration of where and how the generated artifacts are written.
+type OutputConfig struct {
+	Dir    string `json:"dir"`
+	Format string `json:"format"`
+	Stdout bool   `json:"stdout"`
+	Quiet  bool   `json:"quiet"`
+}
+
+// LoadConfig loads the configuration at path. Unknown fields are rejected.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config := &Config{}
+	err = yaml.UnmarshalStrict(raw, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// validate checks the configuration for values that are invalid regardless of the subcommand.
+func (c *Config) validate() error {
+	if c.Prometheus.BearerToken != "" && c.Prometheus.BearerTokenFile != "" {
+		return errors.New("prometheus.bearerToken and prometheus.bearerTokenFile are mutually exclusive")
+	}
+	if c.Cluster.Context != "" && c.Cluster.ManifestsDir != "" {
+		return errors.New("cluster.context and cluster.manifestsDir are mutually exclusive")
+	}
+	if c.Extract.TelemetryConfigMap != "" && !strings.Contains(c.Extract.TelemetryConfigMap, "/") {
+		return fmt.Errorf("extract.telemetryConfigMap: expected <namespace>/<name>, got: %s", c.Extract.TelemetryConfigMap)
+	}
+	if c.Output.Format != "" && !report.IsSupportedFormat(report.Format(c.Output.Format)) {
+		return fmt.Errorf("output.format: unsupported format: %s", c.Output.Format)
+	}
+	for i, ruleFile := range c.Extract.RuleFiles {
+		if ruleFile == "" {
+			return fmt.Errorf("extract.ruleFiles[%d]: empty path", i)
+		}
+	}
+	for i, dashboard := range c.Extract.Dashboards {
+		if dashboard == "" {
+			return fmt.Errorf("extract.dashboards[%d]: empty path", i)
+		}
+	}
+
+	return nil
+}
+
+// registerProfiles registers the user-defined profiles alongside the built-in ones.
+func (c *Config) registerProfiles() error {
+	for i, profile := range c.Profiles {
+		err := profiles.RegisterProfile(profile)
+		if err != nil {
+			return fmt.Errorf("profiles[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// apply sets the options from the configuration, except for the ones whose flags were explicitly set.
+func (c *Config) apply(o *Options, fs *flag.FlagSet) {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	setString := func(name string, dst *string, value string) {
+		if !set[name] && value != "" {
+			*dst = value
+		}
+	}
+	setBool := func(name string, dst *bool, value bool) {
+		if !set[name] && value {
+			*dst = value
+		}
+	}
+
+	setString("address", &o.Address, c.Prometheus.Address)
+	setString("prometheus-service", &o.PrometheusService, c.Prometheus.Service)
+	setString("prometheus-service-mode", &o.PrometheusServiceMode, c.Prometheus.ServiceMode)
+	setString("bearer-token", &o.BearerToken, c.Prometheus.BearerToken)
+	setString("bearer-token-file", &o.BearerTokenFile, c.Prometheus.BearerTokenFile)
+	setString("basic-auth-username", &o.BasicAuthUsername, c.Prometheus.BasicAuth.Username)
+	setString("basic-auth-password-file", &o.BasicAuthPasswordFile, c.Prometheus.BasicAuth.PasswordFile)
+	setString("ca-file", &o.CAFile, c.Prometheus.CAFile)
+	setString("cert-file", &o.CertFile, c.Prometheus.CertFile)
+	setString("key-file", &o.KeyFile, c.Prometheus.KeyFile)
+	setBool("insecure-skip-verify", &o.InsecureSkipVerify, c.Prometheus.InsecureSkipVerify)
+	setString("proxy-url", &o.ProxyURL, c.Prometheus.ProxyURL)
+	if !set["header"] && len(c.Prometheus.Headers) > 0 {
+		o.Headers = c.Prometheus.Headers
+	}
+	if !set["query-param"] && len(c.Prometheus.QueryParams) > 0 {
+		o.QueryParams = c.Prometheus.QueryParams
+	}
+	setString("tenant", &o.Tenant, c.Prometheus.Tenant)
+
+	setString("kubeconfig", &o.KubeconfigPath, c.Cluster.Kubeconfig)
+	setString("context", &o.KubeContext, c.Cluster.Context)
+	setString("manifests-dir", &o.ManifestsDir, c.Cluster.ManifestsDir)
+	setBool("prometheusrules", &o.PrometheusRules, c.Cluster.PrometheusRules)
+	setString("prometheusrules-namespace", &o.PromRuleNamespace, c.Cluster.PrometheusRulesNamespace)
+	setString("prometheusrules-selector", &o.PromRuleSelector, c.Cluster.PrometheusRulesSelector)
+
+	setString("profile", &o.Profile, c.Profile)
+	setBool("noisy", &o.Noisy, c.Noisy)
+	setBool("savings", &o.Savings, c.Savings)
+
+	setString("allow-list-file", &o.AllowListFile, c.Extract.AllowListFile)
+	setString("rule-file", &o.RuleFile, strings.Join(c.Extract.RuleFiles, ","))
+	setString("dashboard", &o.Dashboards, strings.Join(c.Extract.Dashboards, ","))
+	setString("target-selectors", &o.TargetSelectors, c.Extract.TargetSelectors)
+	setString("telemetry-config", &o.TelemetryConfigFile, c.Extract.TelemetryConfig)
+	setString("telemetry-configmap", &o.TelemetryConfigMap, c.Extract.TelemetryConfigMap)
+	setBool("output-cardinality", &o.OutputCardinality, c.Extract.OutputCardinality)
+	setBool("label-cardinality", &o.LabelCardinality, c.Extract.LabelCardinality)
+	if !set["cardinality-parallelism"] && c.Extract.Cardinality.Parallelism != 0 {
+		o.Cardinality.Parallelism = c.Extract.Cardinality.Parallelism
+	}
+	if !set["cardinality-retries"] && c.Extract.Cardinality.Retries != nil {
+		o.Cardinality.Retries = *c.Extract.Cardinality.Retries
+	}
+	if !set["cardinality-query-timeout"] && c.Extract.Cardinality.QueryTimeout != 0 {
+		o.Cardinality.QueryTimeout = time.Duration(c.Extract.Cardinality.QueryTimeout)
+	}
+	if !set["cardinality-rate-limit"] && c.Extract.Cardinality.RateLimit != 0 {
+		o.Cardinality.RateLimit = c.Extract.Cardinality.RateLimit
+	}
+	if !set["lookback"] && c.Extract.Cardinality.Lookback != 0 {
+		o.Cardinality.Lookback = time.Duration(c.Extract.Cardinality.Lookback)
+	}
+	if !set["step"] && c.Extract.Cardinality.Step != 0 {
+		o.Cardinality.Step = time.Duration(c.Extract.Cardinality.Step)
+	}
+
+	setString("output-dir", &o.OutputDir, c.Output.Dir)
+	setString("output-format", &o.OutputFormat, c.Output.Format)
+	setBool("stdout", &o.Stdout, c.Output.Stdout)
+	setBool("quiet", &o.Quiet, c.Output.Quiet)
+}
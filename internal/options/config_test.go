@@ -0,0 +1,108 @@
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := LoadConfig(writeConfig(t, `
+prometheus:
+  address: http://localhost:9090
+  tenant: team-a
+profile: minimal
+extract:
+  ruleFiles:
+  - rules.yaml
+  cardinality:
+    lookback: 1d
+output:
+  format: yaml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Prometheus.Address != "http://localhost:9090" || config.Prometheus.Tenant != "team-a" {
+		t.Errorf("expected the prometheus config to be loaded, got %+v", config.Prometheus)
+	}
+	if config.Profile != "minimal" || len(config.Extract.RuleFiles) != 1 || config.Output.Format != "yaml" {
+		t.Errorf("expected the config to be loaded, got %+v", config)
+	}
+	if got := time.Duration(config.Extract.Cardinality.Lookback); got != 24*time.Hour {
+		t.Errorf("expected a lookback of %s, got %s", model.Duration(24*time.Hour), got)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			content: "prometheus:\n  adress: http://localhost:9090\n",
+			wantErr: `unknown field "adress"`,
+		},
+		{
+			name:    "unknown top-level field",
+			content: "profiles: []\noutputs: {}\n",
+			wantErr: `unknown field "outputs"`,
+		},
+		{
+			name:    "duplicate field",
+			content: "profile: minimal\nprofile: full\n",
+			wantErr: "already set",
+		},
+		{
+			name:    "mutually exclusive bearer tokens",
+			content: "prometheus:\n  bearerToken: foo\n  bearerTokenFile: /var/run/token\n",
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "telemetry configmap without namespace",
+			content: "extract:\n  telemetryConfigMap: telemetry-config\n",
+			wantErr: "expected <namespace>/<name>",
+		},
+		{
+			name:    "unsupported format",
+			content: "output:\n  format: xml\n",
+			wantErr: "unsupported format",
+		},
+		{
+			name:    "empty rule file",
+			content: "extract:\n  ruleFiles:\n  - \"\"\n",
+			wantErr: "extract.ruleFiles[0]: empty path",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadConfig(writeConfig(t, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package options
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/config"
+
+	"github.com/rexagod/cpv/internal/client"
+)
+
+// headersFlag is a flag that may be repeated to set multiple HTTP headers, each as "Name: value".
+type headersFlag map[string]string
+
+func (h *headersFlag) String() string {
+	if h == nil {
+		return ""
+	}
+	var headers []string
+	for name, value := range *h {
+		headers = append(headers, name+": "+value)
+	}
+	sort.Strings(headers)
+
+	return strings.Join(headers, ", ")
+}
+
+func (h *headersFlag) Set(header string) error {
+	name, value, found := strings.Cut(header, ":")
+	if !found || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected the header as 'Name: value', got: %s", header)
+	}
+	if *h == nil {
+		*h = headersFlag{}
+	}
+	(*h)[strings.TrimSpace(name)] = strings.TrimSpace(value)
+
+	return nil
+}
+
+// queryParamsFlag is a flag that may be repeated to set multiple query parameters, each as "name=value".
+type queryParamsFlag map[string]string
+
+func (q *queryParamsFlag) String() string {
+	if q == nil {
+		return ""
+	}
+	var params []string
+	for name, value := range *q {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, ", ")
+}
+
+func (q *queryParamsFlag) Set(param string) error {
+	name, value, found := strings.Cut(param, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected the query parameter as 'name=value', got: %s", param)
+	}
+	if *q == nil {
+		*q = queryParamsFlag{}
+	}
+	(*q)[name] = value
+
+	return nil
+}
+
+// RequestOptions returns the headers and query parameters to apply on every request to the Prometheus instance.
+func (o *Options) RequestOptions() client.RequestOptions {
+	requests := client.RequestOptions{}
+	if len(o.Headers) > 0 || o.Tenant != "" {
+		requests.Headers = map[string]string{}
+		for name, value := range o.Headers {
+			requests.Headers[name] = value
+		}
+		if o.Tenant != "" {
+			requests.Headers[client.TenantHeader] = o.Tenant
+		}
+	}
+	if len(o.QueryParams) > 0 {
+		requests.QueryParams = url.Values{}
+		for name, value := range o.QueryParams {
+			requests.QueryParams.Set(name, value)
+		}
+	}
+
+	return requests
+}
+
+// HTTPClientConfig returns the configuration to connect to the Prometheus instance with, i.e., its TLS, authentication
+// and proxy settings.
+func (o *Options) HTTPClientConfig() (config.HTTPClientConfig, error) {
+	httpConfig := config.DefaultHTTPClientConfig
+	httpConfig.BearerToken = config.Secret(o.BearerToken)
+	httpConfig.BearerTokenFile = o.BearerTokenFile
+	if o.BasicAuthUsername != "" || o.BasicAuthPasswordFile != "" {
+		httpConfig.BasicAuth = &config.BasicAuth{
+			Username:     o.BasicAuthUsername,
+			PasswordFile: o.BasicAuthPasswordFile,
+		}
+	}
+	httpConfig.TLSConfig = config.TLSConfig{
+		CAFile:             o.CAFile,
+		CertFile:           o.CertFile,
+		KeyFile:            o.KeyFile,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return httpConfig, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+		httpConfig.ProxyURL = config.URL{URL: proxyURL}
+	}
+	err := httpConfig.Validate()
+	if err != nil {
+		return httpConfig, fmt.Errorf("invalid HTTP client config: %w", err)
+	}
+	err = httpConfig.TLSConfig.Validate()
+	if err != nil {
+		return httpConfig, fmt.Errorf("invalid TLS config: %w", err)
+	}
+
+	return httpConfig, nil
+}
@@ -2,148 +2,450 @@
 package options
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/prometheus/common/model"
 	"k8s.io/klog/v2"
 
-	v "github.com/rexagod/cpv/internal/version"
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/profiles"
+	"github.com/rexagod/cpv/internal/report"
 )
 
-var (
-	address           string
-	allowListFile     string
-	bearerToken       string
-	kubeconfigPath    string
-	noisy             bool
-	outputCardinality bool
-	profile           string
-	quiet             bool
-	ruleFile          string
-	status            bool
-	targetSelector    string
-	validate          bool
-	version           bool
+// Command is a subcommand of the command, each with its own set of flags and required inputs.
+type Command string
+
+const (
+	CommandExtract  Command = "extract"
+	CommandExplain  Command = "explain"
+	CommandStatus   Command = "status"
+	CommandValidate Command = "validate"
+	CommandVersion  Command = "version"
 )
 
-func init() {
+// Commands are all the supported subcommands, in the order they are listed in the usage.
+var Commands = []Command{CommandExtract, CommandExplain, CommandStatus, CommandValidate, CommandVersion}
+
+// commandDescriptions describe what each subcommand does.
+var commandDescriptions = map[Command]string{
+	CommandExtract:  "Extract the metrics needed to implement a collection profile.",
+	CommandExplain:  "Explain why a metric is extracted for a collection profile, as: explain [flags] <metric>.",
+	CommandStatus:   "Report collection profiles' implementation status.",
+	CommandValidate: "Validate the collection profile implementation.",
+	CommandVersion:  "Print version information.",
+}
+
+// ErrUsage is returned if the command or its flags are invalid, after the usage has been printed.
+var ErrUsage = errors.New("invalid usage")
+
+// Options contains the options for the command.
+type Options struct {
+	Command               Command
+	Address               string
+	AllowListFile         string
+	BasicAuthPasswordFile string
+	BasicAuthUsername     string
+	BearerToken           string
+	BearerTokenFile       string
+	Cardinality           client.CardinalityOptions
+	CAFile                string
+	CertFile              string
+	ConfigFile            string
+	Dashboards            string
+	Headers               map[string]string
+	InsecureSkipVerify    bool
+	KeyFile               string
+	KubeconfigPath        string
+	KubeContext           string
+	LabelCardinality      bool
+	ManifestsDir          string
+	Metric                string
+	Noisy                 bool
+	OutputCardinality     bool
+	OutputDir             string
+	OutputFormat          string
+	Profile               string
+	PrometheusRules       bool
+	PrometheusService     string
+	PrometheusServiceMode string
+	ProxyURL              string
+	QueryParams           map[string]string
+	PromRuleNamespace     string
+	PromRuleSelector      string
+	Quiet                 bool
+	RuleFile              string
+	Savings               bool
+	Stdout                bool
+	TargetSelectors       string
+	TelemetryConfigFile   string
+	TelemetryConfigMap    string
+	Tenant                string
 
-	// Mandatory flags.
-	flag.StringVar(&address, "address", "http://localhost:9090", "Address of the Prometheus instance.")
-	flag.StringVar(&bearerToken, "bearer-token", "", "Bearer token for authentication.")
-	flag.StringVar(&kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to kubeconfig file. Defaults to $KUBECONFIG.")
+	// prometheusSet is true if the Prometheus instance was explicitly set, through either the flags or the config.
+	prometheusSet bool
+}
 
-	// Independent flags.
-	flag.BoolVar(&noisy, "noisy", false, "Enable noisy assumptions: interpret the absence of the collection profiles label as the default 'full' profile (when using the -status flag).")
-	flag.BoolVar(&outputCardinality, "output-cardinality", false, "Output cardinality of all extracted metrics to a file.")
-	flag.StringVar(&profile, "profile", "", "Collection profile that the command is being run for.")
-	flag.BoolVar(&quiet, "quiet", false, "Suppress all output, and use $EDITOR for generated manifests.")
-	flag.BoolVar(&version, "version", false, "Print version information.")
+func (o *Options) HasExtractor() bool {
+	return o.AllowListFile != "" || o.Dashboards != "" || o.RuleFile != "" || o.TargetSelectors != "" ||
+		o.TelemetryConfigFile != "" || o.TelemetryConfigMap != ""
+}
 
-	// Dependent flags.
-	flag.StringVar(&allowListFile, "allow-list-file", "", "Path to a file containing a list of allow-listed metrics that will always be included within the extracted metrics set. Requires -profile flag to be set.")
-	flag.StringVar(&ruleFile, "rule-file", "", "Path to a valid rule file to extract metrics from, for eg., https://github.com/prometheus/prometheus/blob/v0.45.0/model/rulefmt/testdata/test.yaml. Requires -profile flag to be set.")
-	flag.BoolVar(&status, "status", false, "Report collection profiles' implementation status. -profile may be empty to report status for all profiles.")
-	flag.StringVar(&targetSelector, "target-selectors", "", "Target selectors used to extract metrics, for eg., https://github.com/prometheus/client_golang/blob/644c80d1360fb1409a3fe8dfc5bad4228f282f3b/api/prometheus/v1/api_test.go#L1007. Requires -profile flag to be set.")
-	flag.BoolVar(&validate, "validate", false, "Validate the collection profile implementation. Requires -profile flag to be set.")
+// NeedsPrometheus returns true if the subcommand queries the Prometheus instance. Validating rendered manifests only
+// does so if the Prometheus instance was explicitly set, or to project the -savings, so that it may run offline.
+// Likewise, extracting from local sources (allow-list, rule files, dashboards and telemetry config) only does so if the
+// Prometheus instance was explicitly set, or to source the -target-selectors, or evaluate cardinalities or savings.
+func (o *Options) NeedsPrometheus() bool {
+	switch o.Command {
+	case CommandExtract:
+		return o.prometheusSet || o.TargetSelectors != "" || o.OutputCardinality || o.LabelCardinality || o.Savings
+	case CommandExplain:
+		return o.prometheusSet || o.TargetSelectors != ""
+	case CommandValidate:
+		return o.ManifestsDir == "" || o.prometheusSet || o.Savings
+	case CommandStatus, CommandVersion:
+	}
 
-	// Check if -quiet flag is set.
-	var didQuiet bool
-	for _, arg := range os.Args[1:] {
-		if arg == "-quiet" {
-			didQuiet = true
+	return false
+}
 
-			break
+// HasCluster returns true if the monitors and rules may be sourced from either the cluster, or rendered manifests.
+func (o *Options) HasCluster() bool {
+	return o.KubeconfigPath != "" || o.ManifestsDir != ""
+}
+
+// NewOptions returns the Options for the subcommand within args (excluding the program name), and validates that its
+// required inputs are set. flag.ErrHelp is returned if help was requested, and ErrUsage if the usage was invalid, in
+// which case the usage has already been printed.
+func NewOptions(args []string) (*Options, error) {
+	if len(args) == 0 {
+		Usage(os.Stderr)
+
+		return nil, ErrUsage
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		Usage(os.Stderr)
+
+		return nil, flag.ErrHelp
+	}
+
+	o := &Options{Command: Command(args[0])}
+	fs := newFlagSet(o)
+	if fs == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", args[0])
+		Usage(os.Stderr)
+
+		return nil, ErrUsage
+	}
+	err := fs.Parse(args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
 		}
+
+		return nil, ErrUsage
 	}
 
-	// Set klog behavior.
-	if didQuiet {
-		klog.InitFlags(nil)
-		err := flag.Set("logtostderr", "false")
+	// The metric to explain may be followed by more flags.
+	if o.Command == CommandExplain && fs.NArg() > 0 {
+		o.Metric = fs.Arg(0)
+		err = fs.Parse(fs.Args()[1:])
 		if err != nil {
-			panic(err)
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+
+			return nil, ErrUsage
 		}
-		klogFile, err := os.CreateTemp(".", "cpv-klog-*.log")
-		if err != nil {
-			panic(err)
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "address" || f.Name == "prometheus-service" {
+			o.prometheusSet = true
 		}
+	})
 
-		// NOTE: all klog.Error* logs will still be printed to stdout.
-		err = flag.Set("log_file", klogFile.Name())
+	// Fill in the options that were not explicitly set through flags from the config, if any.
+	if o.ConfigFile != "" {
+		config, err := LoadConfig(o.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		err = config.registerProfiles()
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid config %s: %w", o.ConfigFile, err)
+		}
+		config.apply(o, fs)
+		if config.Prometheus.Address != "" || config.Prometheus.Service != "" {
+			o.prometheusSet = true
 		}
 	}
 
-	// Parse flags.
-	flag.Parse()
+	err = o.validate()
+	if err != nil {
+		return nil, err
+	}
 
-	if version {
-		v.Println()
-		if flag.NFlag() == 1 {
-			os.Exit(0)
+	// Log to a file within the output directory, if -quiet flag is set.
+	if o.Quiet {
+		err = quietLogs(o.OutputDir)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if len(bearerToken) == 0 {
-		klog.Fatal("Bearer token must be set")
+	return o, nil
+}
+
+// Usage prints the usage of all subcommands, along with their flags.
+func Usage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "Usage: cpv <command> [flags]\n\nCommands:\n")
+	for _, command := range Commands {
+		_, _ = fmt.Fprintf(w, "  %-9s %s\n", command, commandDescriptions[command])
 	}
-	if len(address) == 0 {
-		klog.Fatal("Address must be set")
+	_, _ = fmt.Fprintf(w, "\nProfiles (more may be defined within the -config):\n")
+	for _, profile := range profiles.SupportedCollectionProfiles() {
+		p, _ := profiles.LookupProfile(profile)
+		_, _ = fmt.Fprintf(w, "  %-9s %s\n", p.Name, p.Description)
 	}
-	if len(kubeconfigPath) == 0 {
-		klog.Fatal("KUBECONFIG must be set")
+	for _, command := range Commands {
+		fs := newFlagSet(&Options{Command: command})
+		if !hasFlags(fs) {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "\nFlags for %s:\n", command)
+		fs.SetOutput(w)
+		fs.PrintDefaults()
 	}
 }
 
-// Options contains the options for the command.
-type Options struct {
-	Address           string
-	AllowListFile     string
-	BearerToken       string
-	KubeconfigPath    string
-	Noisy             bool
-	OutputCardinality bool
-	Profile           string
-	Quiet             bool
-	RuleFile          string
-	Status            bool
-	TargetSelectors   string
-	Validate          bool
+// validate checks that the inputs required by the subcommand are set.
+func (o *Options) validate() error {
+	if o.Quiet && o.Stdout {
+		return errors.New("-quiet and -stdout are mutually exclusive")
+	}
+	if o.OutputFormat != "" && !report.IsSupportedFormat(report.Format(o.OutputFormat)) {
+		return fmt.Errorf("unsupported output format: %s", o.OutputFormat)
+	}
+	if o.Stdout && report.Format(o.OutputFormat) == report.FormatJSON && (o.Command == CommandExtract || o.Savings) {
+		return errors.New("-stdout may not be used with -output-format=json when multiple artifacts are written, use -output-dir instead")
+	}
+	switch o.Command {
+	case CommandExtract:
+		if o.Profile == "" {
+			return errors.New("-profile must be set")
+		}
+		if !o.HasExtractor() {
+			return errors.New("at least one of -allow-list-file, -dashboard, -rule-file, -target-selectors, -telemetry-config or -telemetry-configmap must be set")
+		}
+		if o.Cardinality.Parallelism < 1 || o.Cardinality.Retries < 0 || o.Cardinality.RateLimit < 0 {
+			return errors.New("-cardinality-parallelism must be positive, and -cardinality-retries and -cardinality-rate-limit must not be negative")
+		}
+		if o.Cardinality.Lookback < 0 || o.Cardinality.Step <= 0 {
+			return errors.New("-lookback must not be negative, and -step must be positive")
+		}
+		if o.Cardinality.Lookback/o.Cardinality.Step >= client.MaxRangePoints {
+			return fmt.Errorf("-lookback spans more than %d steps, increase the -step", client.MaxRangePoints)
+		}
+		if o.Savings && !o.HasCluster() {
+			return errors.New("KUBECONFIG or -manifests-dir must be set to project the -savings")
+		}
+		if o.TelemetryConfigMap != "" && o.KubeconfigPath == "" {
+			return errors.New("KUBECONFIG must be set to fetch the -telemetry-configmap")
+		}
+
+		return o.validatePrometheus()
+	case CommandExplain:
+		if o.Metric == "" {
+			return errors.New("the metric to explain must be set")
+		}
+		if o.Profile == "" {
+			return errors.New("-profile must be set")
+		}
+		if !o.HasExtractor() {
+			return errors.New("at least one of -allow-list-file, -dashboard, -rule-file, -target-selectors, -telemetry-config or -telemetry-configmap must be set")
+		}
+		if o.TelemetryConfigMap != "" && o.KubeconfigPath == "" {
+			return errors.New("KUBECONFIG must be set to fetch the -telemetry-configmap")
+		}
+
+		return o.validatePrometheus()
+	case CommandStatus:
+		if !o.HasCluster() {
+			return errors.New("KUBECONFIG or -manifests-dir must be set")
+		}
+	case CommandValidate:
+		if o.Profile == "" {
+			return errors.New("-profile must be set")
+		}
+		if !o.HasCluster() {
+			return errors.New("KUBECONFIG or -manifests-dir must be set")
+		}
+		if !o.NeedsPrometheus() {
+			return nil
+		}
+
+		return o.validatePrometheus()
+	case CommandVersion:
+	}
+
+	return nil
 }
 
-func (o *Options) HasExtractor() bool {
-	return o.AllowListFile != "" || o.RuleFile != "" || o.TargetSelectors != ""
+// validatePrometheus checks that the inputs required to query the Prometheus instance are set.
+func (o *Options) validatePrometheus() error {
+	if o.PrometheusService != "" {
+		_, err := client.ParseService(o.PrometheusService)
+		if err != nil {
+			return err
+		}
+		switch client.ServiceMode(o.PrometheusServiceMode) {
+		case client.ServiceModeProxy, client.ServiceModePortForward:
+		default:
+			return fmt.Errorf("unsupported Prometheus service mode: %s", o.PrometheusServiceMode)
+		}
+		if o.KubeconfigPath == "" {
+			return errors.New("KUBECONFIG must be set to reach the -prometheus-service")
+		}
+	} else if len(o.Address) == 0 {
+		return errors.New("address must be set")
+	}
+	_, err := o.HTTPClientConfig()
+
+	return err
 }
 
-func (o *Options) IsUp() error {
-	// nolint: noctx
-	response, err := http.Get(o.Address)
-	if err != nil {
-		return fmt.Errorf("failed to get response from %s: %w", o.Address, err)
+// newFlagSet returns the flag set for the subcommand, bound to o, or nil if the subcommand is not supported.
+func newFlagSet(o *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet(string(o.Command), flag.ContinueOnError)
+	if o.Command != CommandVersion {
+		fs.StringVar(&o.ConfigFile, "config", "", "Path to a YAML config file holding the options, that the explicitly set flags override.")
+	}
+	switch o.Command {
+	case CommandExtract:
+		addPrometheusFlags(fs, o)
+		addClusterFlags(fs, o)
+		addOutputFlags(fs, o)
+		addSourceFlags(fs, o)
+		fs.BoolVar(&o.OutputCardinality, "output-cardinality", false, "Include the cardinality of all extracted metrics within the extraction report.")
+		fs.IntVar(&o.Cardinality.Parallelism, "cardinality-parallelism", client.DefaultCardinalityOptions.Parallelism, "Number of cardinality queries in flight at once (when using the -output-cardinality flag).")
+		fs.DurationVar(&o.Cardinality.QueryTimeout, "cardinality-query-timeout", client.DefaultCardinalityOptions.QueryTimeout, "Timeout for every attempt of a cardinality query (when using the -output-cardinality flag).")
+		fs.Float64Var(&o.Cardinality.RateLimit, "cardinality-rate-limit", client.DefaultCardinalityOptions.RateLimit, "Cardinality queries per second, 0 for unlimited (when using the -output-cardinality flag).")
+		fs.BoolVar(&o.LabelCardinality, "label-cardinality", false, "Break every extracted metric down by label within the extraction report, and suggest a labeldrop relabel config for the labels that the rules, dashboards, telemetry config and allow-list do not reference.")
+		fs.Var((*model.Duration)(&o.Cardinality.Lookback), "lookback", "Window to evaluate the cardinality over through range queries, as a `duration`, for eg., '7d', reporting the min, avg, max and p95 series count of every metric, and flagging the ones absent now (when using the -output-cardinality flag). Leave empty to only evaluate the current cardinality.")
+		fs.IntVar(&o.Cardinality.Retries, "cardinality-retries", client.DefaultCardinalityOptions.Retries, "Number of times a cardinality query that failed with a 5xx or 429 is retried, with exponential backoff (when using the -output-cardinality flag).")
+		fs.StringVar(&o.Profile, "profile", "", "Collection profile to extract the metrics for.")
+		o.Cardinality.Step = client.DefaultCardinalityOptions.Step
+		fs.Var((*model.Duration)(&o.Cardinality.Step), "step", "Resolution of the range queries over the -lookback window, as a `duration`.")
+		fs.BoolVar(&o.Savings, "savings", false, "Write a savings report projecting the series, samples per second and storage that the extracted metrics save over the full scrape, per monitor and per namespace. Requires KUBECONFIG or -manifests-dir.")
+	case CommandExplain:
+		addPrometheusFlags(fs, o)
+		addClusterFlags(fs, o)
+		addSourceFlags(fs, o)
+		fs.StringVar(&o.OutputFormat, "output-format", string(report.FormatTable), "Format of the explanation, one of: table, json, yaml.")
+		fs.StringVar(&o.Profile, "profile", "", "Collection profile to explain the metric for.")
+	case CommandStatus:
+		addClusterFlags(fs, o)
+		addOutputFlags(fs, o)
+		fs.BoolVar(&o.Noisy, "noisy", false, "Enable noisy assumptions: interpret the absence of the collection profiles label as the default 'full' profile.")
+		fs.StringVar(&o.Profile, "profile", "", "Collection profile to report the status for. Leave empty to report the status for all profiles.")
+	case CommandValidate:
+		addPrometheusFlags(fs, o)
+		addClusterFlags(fs, o)
+		addOutputFlags(fs, o)
+		fs.BoolVar(&o.Noisy, "noisy", false, "Enable noisy assumptions: interpret the absence of the collection profiles label as the default 'full' profile.")
+		fs.StringVar(&o.Profile, "profile", "", "Collection profile to validate.")
+		fs.BoolVar(&o.PrometheusRules, "prometheusrules", false, "Validate against the PrometheusRule resources in the cluster, instead of the rules loaded by the Prometheus instance.")
+		fs.StringVar(&o.PromRuleNamespace, "prometheusrules-namespace", "", "Namespace to look for PrometheusRule resources in. Defaults to all namespaces. Requires -prometheusrules or -manifests-dir flag to be set.")
+		fs.StringVar(&o.PromRuleSelector, "prometheusrules-selector", "", "Label selector to filter PrometheusRule resources with, for eg., 'app.kubernetes.io/part-of=openshift-monitoring'. Requires -prometheusrules or -manifests-dir flag to be set.")
+		fs.BoolVar(&o.Savings, "savings", false, "Write a savings report projecting the series, samples per second and storage that the implemented profile-specific monitors save over the full scrape, per monitor and per namespace.")
+	case CommandVersion:
+	default:
+		return nil
 	}
-	defer response.Body.Close()
 
-	return nil
+	return fs
+}
+
+// addPrometheusFlags adds the flags to connect to the Prometheus instance.
+func addPrometheusFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.Address, "address", "http://localhost:9090", "Address of the Prometheus instance.")
+	fs.StringVar(&o.BasicAuthPasswordFile, "basic-auth-password-file", "", "Path to a file containing the password for basic authentication.")
+	fs.StringVar(&o.BasicAuthUsername, "basic-auth-username", "", "Username for basic authentication.")
+	fs.StringVar(&o.BearerToken, "bearer-token", "", "Bearer token for authentication.")
+	fs.StringVar(&o.BearerTokenFile, "bearer-token-file", "", "Path to a file containing the bearer token for authentication, re-read on every request to pick up rotated tokens.")
+	fs.StringVar(&o.CAFile, "ca-file", "", "Path to the CA certificate to verify the Prometheus instance's certificate with.")
+	fs.StringVar(&o.CertFile, "cert-file", "", "Path to the client certificate for mTLS.")
+	fs.Var((*headersFlag)(&o.Headers), "header", "HTTP header to set on every request to the Prometheus instance, as 'Name: value'. May be repeated.")
+	fs.BoolVar(&o.InsecureSkipVerify, "insecure-skip-verify", false, "Skip verifying the Prometheus instance's certificate.")
+	fs.StringVar(&o.KeyFile, "key-file", "", "Path to the client key for mTLS.")
+	fs.StringVar(&o.PrometheusService, "prometheus-service", "", "Prometheus service within the cluster, as <namespace>/[<scheme>:]<name>:<port>, for eg., 'openshift-monitoring/https:prometheus-k8s:web', to reach through the kubeconfig instead of -address.")
+	fs.StringVar(&o.PrometheusServiceMode, "prometheus-service-mode", string(client.ServiceModeProxy), "How to reach the -prometheus-service, one of: proxy (through the API server's service proxy), port-forward (through an in-process port-forward to one of its pods).")
+	fs.StringVar(&o.ProxyURL, "proxy-url", "", "URL of the proxy to connect to the Prometheus instance through.")
+	fs.Var((*queryParamsFlag)(&o.QueryParams), "query-param", "Query parameter to add to every request to the Prometheus instance, as 'name=value', for eg., 'namespace=openshift-etcd' for the kube-rbac-proxy tenancy port. May be repeated.")
+	fs.StringVar(&o.Tenant, "tenant", "", "Tenant to query on behalf of, set as the X-Scope-OrgID header on every request to the Prometheus instance, for eg., Thanos or Cortex.")
+}
+
+// addClusterFlags adds the flags to source the monitors and rules from.
+func addClusterFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.KubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to kubeconfig file. Defaults to $KUBECONFIG. Not required if -manifests-dir is set.")
+	fs.StringVar(&o.KubeContext, "context", "", "Kubeconfig context to use. Defaults to the current context.")
+	fs.StringVar(&o.ManifestsDir, "manifests-dir", "", "Path to a directory of rendered manifests (ServiceMonitor, PodMonitor and PrometheusRule resources) to use instead of the cluster, for eg., kustomize or helm output.")
+}
+
+// addSourceFlags adds the flags for the sources that define the metrics a profile requires.
+func addSourceFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.AllowListFile, "allow-list-file", "", "Path to a file containing a list of allow-listed metrics that will always be included within the extracted metrics set.")
+	fs.StringVar(&o.Dashboards, "dashboard", "", "Comma-separated paths to Grafana dashboard JSON files, or ConfigMap manifests holding them, to extract metrics from panel targets and templating variables.")
+	fs.StringVar(&o.RuleFile, "rule-file", "", "Comma-separated paths to valid rule files to extract metrics from, following recording rules back to the scraped metrics they depend on, for eg., https://github.com/prometheus/prometheus/blob/v0.45.0/model/rulefmt/testdata/test.yaml.")
+	fs.StringVar(&o.TargetSelectors, "target-selectors", "", "Target selectors used to extract metrics, for eg., https://github.com/prometheus/client_golang/blob/644c80d1360fb1409a3fe8dfc5bad4228f282f3b/api/prometheus/v1/api_test.go#L1007.")
+	fs.StringVar(&o.TelemetryConfigFile, "telemetry-config", "", "Path to a telemetry config (the cluster-monitoring-operator's 'matches' list of series selectors), or a ConfigMap manifest holding it, to extract metrics from.")
+	fs.StringVar(&o.TelemetryConfigMap, "telemetry-configmap", "", "Telemetry config ConfigMap in the cluster, as <namespace>/<name>, for eg., 'openshift-monitoring/telemetry-config', to extract metrics from. Requires KUBECONFIG.")
+}
+
+// addOutputFlags adds the flags that control where and how the generated artifacts are written.
+func addOutputFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.OutputDir, "output-dir", "/tmp", "Directory to write the generated reports and manifests to, with stable, profile-scoped file names. Existing files are overwritten.")
+	fs.StringVar(&o.OutputFormat, "output-format", string(report.FormatTable), "Format of the generated reports, one of: table, json, yaml.")
+	fs.BoolVar(&o.Quiet, "quiet", false, "Suppress all output, and use $EDITOR for generated manifests.")
+	fs.BoolVar(&o.Stdout, "stdout", false, "Write the generated reports and manifests to stdout instead of -output-dir.")
 }
 
-// NewOptions returns a new Options.
-func NewOptions() *Options {
-	return &Options{
-		Address:           address,
-		AllowListFile:     allowListFile,
-		BearerToken:       bearerToken,
-		KubeconfigPath:    kubeconfigPath,
-		Noisy:             noisy,
-		OutputCardinality: outputCardinality,
-		Profile:           profile,
-		Quiet:             quiet,
-		RuleFile:          ruleFile,
-		Status:            status,
-		TargetSelectors:   targetSelector,
-		Validate:          validate,
+// hasFlags returns true if any flags are defined within the flag set.
+func hasFlags(fs *flag.FlagSet) bool {
+	has := false
+	fs.VisitAll(func(*flag.Flag) {
+		has = true
+	})
+
+	return has
+}
+
+// quietLogs redirects the logs to a file within dir.
+func quietLogs(dir string) error {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	err = fs.Set("logtostderr", "false")
+	if err != nil {
+		return fmt.Errorf("failed to set logtostderr: %w", err)
 	}
+
+	// NOTE: all klog.Error* logs will still be printed to stdout.
+	err = fs.Set("log_file", filepath.Join(dir, "cpv.log"))
+	if err != nil {
+		return fmt.Errorf("failed to set log_file: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,38 @@
+package options
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNeedsPrometheus(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"extract", "-profile", "minimal", "-allow-list-file", "allow-list.yaml"}},
+		{args: []string{"extract", "-profile", "minimal", "-rule-file", "rules.yaml", "-dashboard", "nodes.json"}},
+		{args: []string{"explain", "-profile", "minimal", "-telemetry-config", "metrics.yaml", "up"}},
+		{args: []string{"extract", "-profile", "minimal", "-allow-list-file", "allow-list.yaml", "-address", "http://localhost:9090"}, want: true},
+		{args: []string{"extract", "-profile", "minimal", "-allow-list-file", "allow-list.yaml", "-output-cardinality"}, want: true},
+		{args: []string{"extract", "-profile", "minimal", "-target-selectors", `{job="etcd"}`}, want: true},
+		{args: []string{"explain", "-profile", "minimal", "-target-selectors", `{job="etcd"}`, "up"}, want: true},
+		{args: []string{"validate", "-profile", "minimal", "-manifests-dir", "manifests"}},
+		{args: []string{"validate", "-profile", "minimal", "-manifests-dir", "manifests", "-savings"}, want: true},
+	} {
+		tc := tc
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			t.Parallel()
+
+			o, err := NewOptions(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := o.NeedsPrometheus(); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package output writes the artifacts generated by the command, i.e., the reports and manifests, either to files with
+// stable names within an output directory, or straight to stdout.
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// ErrMultipleJSON is returned when writing more than one artifact to stdout in the JSON format, as the concatenated
+// documents would not parse.
+var ErrMultipleJSON = errors.New("only a single artifact may be written to stdout in the json format, use an output directory instead")
+
+// Writer writes the generated artifacts, and keeps track of the files written.
+type Writer struct {
+	dir    string
+	stdout *trackingWriter
+	format report.Format
+	files  []string
+}
+
+// trackingWriter keeps track of how many artifacts were written to the underlying writer, and the last byte written.
+type trackingWriter struct {
+	io.Writer
+	artifacts int
+	last      byte
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	n, err := t.Writer.Write(p)
+	if n > 0 {
+		t.last = p[n-1]
+	}
+
+	//nolint:wrapcheck
+	return n, err
+}
+
+// NewWriter returns a Writer that writes artifacts to files within dir, or to stdout if toStdout is set. Reports are
+// rendered in the given format.
+func NewWriter(dir string, toStdout bool, format report.Format) *Writer {
+	w := &Writer{
+		dir:    dir,
+		format: format,
+	}
+	if toStdout {
+		w.stdout = &trackingWriter{Writer: os.Stdout}
+	}
+
+	return w
+}
+
+// Format returns the format that reports are rendered in.
+func (w *Writer) Format() report.Format {
+	return w.format
+}
+
+// Files returns the names of all files written so far, in the order they were written.
+func (w *Writer) Files() []string {
+	return w.files
+}
+
+// Write writes an artifact named name, using write, and returns the path of the file it was written to, or nothing if it
+// was written to stdout. Writing an artifact with the same name as a previous run overwrites it, so consecutive runs may
+// be diffed. Artifacts written to stdout are separated as YAML documents, so that the output may be piped to, for eg.,
+// kubectl apply.
+func (w *Writer) Write(name string, write func(io.Writer) error) (string, error) {
+	if w.stdout != nil {
+		if w.stdout.artifacts > 0 {
+			if w.format == report.FormatJSON {
+				return "", fmt.Errorf("failed to write %s: %w", name, ErrMultipleJSON)
+			}
+			separator := "---\n"
+			if w.stdout.last != '\n' {
+				separator = "\n" + separator
+			}
+			_, err := io.WriteString(w.stdout, separator)
+			if err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+		w.stdout.artifacts++
+		err := write(w.stdout)
+		if err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+
+		return "", nil
+	}
+
+	err := os.MkdirAll(w.dir, 0o750)
+	if err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(w.dir, name)
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	err = write(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	for _, file := range w.files {
+		if file == path {
+			return path, nil
+		}
+	}
+	w.files = append(w.files, path)
+
+	return path, nil
+}
+
+// WriteReport writes the report, rendered in the writer's format, as an artifact named name, suffixed by the format's
+// extension, and returns the path of the file it was written to, if any.
+func (w *Writer) WriteReport(name string, r *report.Report) (string, error) {
+	return w.Write(name+"."+w.format.Extension(), func(out io.Writer) error {
+		return r.Write(out, w.format)
+	})
+}
+
+// WriteString writes the string as an artifact named name, and returns the path of the file it was written to, if any.
+func (w *Writer) WriteString(name, s string) (string, error) {
+	return w.Write(name, func(out io.Writer) error {
+		_, err := io.WriteString(out, s)
+
+		//nolint:wrapcheck
+		return err
+	})
+}
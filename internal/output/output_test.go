@@ -0,0 +1,119 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// newStdoutWriter returns a Writer that writes to b, in the same way it writes to stdout.
+func newStdoutWriter(b *bytes.Buffer, format report.Format) *Writer {
+	return &Writer{
+		stdout: &trackingWriter{Writer: b},
+		format: format,
+	}
+}
+
+func TestWriteStdoutYAML(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	w := newStdoutWriter(&b, report.FormatYAML)
+	file, err := w.WriteReport("minimal-extraction-report", report.New(report.KindExtraction, "minimal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "" {
+		t.Errorf("expected no file to be referred to, got %s", file)
+	}
+	_, err = w.WriteString("minimal-relabel-config.yaml", "action: keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteString("minimal-monitors.yaml", "kind: ServiceMonitor\n---\nkind: PodMonitor\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	decoder := yaml.NewYAMLOrJSONDecoder(&b, 4096)
+	for {
+		document := map[string]interface{}{}
+		err = decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to decode the output: %v", err)
+		}
+		kind, _ := document["kind"].(string)
+		if action, ok := document["action"].(string); ok {
+			kind = action
+		}
+		kinds = append(kinds, kind)
+	}
+	if got, want := strings.Join(kinds, ","), "ExtractionReport,keep,ServiceMonitor,PodMonitor"; got != want {
+		t.Errorf("expected the documents %s, got %s", want, got)
+	}
+	if len(w.Files()) != 0 {
+		t.Errorf("expected no files to be written, got %v", w.Files())
+	}
+}
+
+func TestWriteStdoutJSON(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	w := newStdoutWriter(&b, report.FormatJSON)
+	_, err := w.WriteReport("implementation-status", report.New(report.KindStatus, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteString("minimal-relabel-config.yaml", "action: keep\n")
+	if !errors.Is(err, ErrMultipleJSON) {
+		t.Errorf("expected %v, got %v", ErrMultipleJSON, err)
+	}
+}
+
+func TestWriteDir(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	w := NewWriter(dir, false, report.FormatJSON)
+	for _, content := range []string{"first", "second"} {
+		file, err := w.WriteString("minimal-relabel-config.yaml", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, "minimal-relabel-config.yaml"); file != want {
+			t.Errorf("expected %s, got %s", want, file)
+		}
+	}
+	file, err := w.WriteReport("minimal-validation-report", report.New(report.KindValidation, "minimal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(file) != "minimal-validation-report.json" {
+		t.Errorf("expected the report to be named after the format, got %s", file)
+	}
+
+	// Consecutive writes overwrite the artifact.
+	b, err := os.ReadFile(filepath.Join(dir, "minimal-relabel-config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "second" {
+		t.Errorf("expected the artifact to be overwritten, got %q", b)
+	}
+	if len(w.Files()) != 2 {
+		t.Errorf("expected 2 files to be recorded, got %v", w.Files())
+	}
+}
@@ -0,0 +1,413 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+
+	"github.com/rexagod/cpv/internal/report"
+)
+
+const (
+	// dashboardVariablePlaceholder replaces the Grafana variables that stand for a vector selector, or a part of it, so
+	// that the expression parses. Metrics named after it are never reported.
+	dashboardVariablePlaceholder = "__cpv_dashboard_variable__"
+
+	// dashboardDurationPlaceholder replaces the Grafana variables within range selectors, subqueries and offsets.
+	dashboardDurationPlaceholder = "5m"
+
+	// dashboardScalarPlaceholder replaces the Grafana variables that stand for a scalar, i.e., the ones passed as scalar
+	// arguments to functions and aggregations, for eg., topk($topn, ...), or the ones following the @ modifier.
+	dashboardScalarPlaceholder = "1"
+)
+
+var (
+	// dashboardVariableRegex matches Grafana variables in all three supported syntaxes: $var, ${var[:format]} and
+	// [[var[:format]]].
+	dashboardVariableRegex = regexp.MustCompile(`\$\{[^}]+\}|\$\w+|\[\[\w+(?::\w+)?\]\]`)
+
+	// dashboardScalarAggregations are the aggregations whose first argument is a scalar.
+	dashboardScalarAggregations = sets.New[string]("topk", "bottomk", "quantile")
+
+	// dashboardLabelValuesRegex matches the label_values([metric, ]label) templating query.
+	dashboardLabelValuesRegex = regexp.MustCompile(`^\s*label_values\((.*)\)\s*$`)
+
+	// dashboardQueryResultRegex matches the query_result(query) templating query.
+	dashboardQueryResultRegex = regexp.MustCompile(`^\s*query_result\((.*)\)\s*$`)
+)
+
+// extractMetricsFromDashboards returns the metrics used within the panels and templating variables of all Grafana
+// dashboards at the given paths, along with the panels and variables that query them. A path may point to the dashboard
+// JSON itself, or to ConfigMap manifests holding dashboards. The labels that the queries reference are marked within
+// usage, if set.
+func extractMetricsFromDashboards(paths []string, usage *labelUsage) (map[string][]report.Provenance, error) {
+	provenance := map[string][]report.Provenance{}
+	for _, path := range paths {
+		dashboards, err := loadDashboards(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, dashboard := range dashboards {
+			title, _ := dashboard["title"].(string)
+			seen := sets.Set[string]{}
+			for _, query := range collectDashboardQueries(dashboard, "") {
+				expr, err := parser.ParseExpr(interpolateDashboardVariables(query.expr))
+				if err != nil {
+					// Panels may use non-Prometheus data sources, so do not fail the extraction altogether.
+					klog.Warningf("skipping unparseable query %q in %s: %v", query.expr, path, err)
+
+					continue
+				}
+				usage.addExpr(expr)
+				for _, metric := range sets.List(extractMetricsFromExpr(expr)) {
+					// Metric names built from variables cannot be resolved.
+					if strings.Contains(metric, dashboardVariablePlaceholder) || seen.Has(metric+"/"+query.panel) {
+						continue
+					}
+					seen.Insert(metric + "/" + query.panel)
+					provenance[metric] = append(provenance[metric], report.Provenance{
+						Source:    string(SourceDashboards),
+						Location:  path,
+						Dashboard: title,
+						Panel:     query.panel,
+					})
+				}
+			}
+		}
+	}
+
+	// Queries are collected in no particular order.
+	for _, metricProvenance := range provenance {
+		sort.SliceStable(metricProvenance, func(i, j int) bool {
+			a, b := metricProvenance[i], metricProvenance[j]
+			if a.Location != b.Location {
+				return a.Location < b.Location
+			}
+			if a.Dashboard != b.Dashboard {
+				return a.Dashboard < b.Dashboard
+			}
+
+			return a.Panel < b.Panel
+		})
+	}
+
+	return provenance, nil
+}
+
+// loadDashboards returns the dashboards within the file at path, which may either be a dashboard, or a (list of)
+// ConfigMap(s) with dashboards as their data values.
+func loadDashboards(path string) ([]map[string]interface{}, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dashboard file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var dashboards []map[string]interface{}
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		object := map[string]interface{}{}
+		err = decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		objects := []interface{}{object}
+		if items, ok := object["items"].([]interface{}); ok && object["kind"] == "List" {
+			objects = items
+		}
+		for _, o := range objects {
+			m, ok := o.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if m["kind"] != "ConfigMap" {
+				dashboards = append(dashboards, m)
+
+				continue
+			}
+			data, _ := m["data"].(map[string]interface{})
+			for key, value := range data {
+				raw, ok := value.(string)
+				if !ok || !strings.HasSuffix(key, ".json") {
+					continue
+				}
+				dashboard := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(raw), &dashboard); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal dashboard %s in %s: %w", key, path, err)
+				}
+				dashboards = append(dashboards, dashboard)
+			}
+		}
+	}
+
+	return dashboards, nil
+}
+
+// dashboardQuery is a PromQL expression within a dashboard, along with the title of the panel, or the name of the
+// templating variable, it belongs to.
+type dashboardQuery struct {
+	expr  string
+	panel string
+}
+
+// collectDashboardQueries walks the dashboard and returns the PromQL expressions of all panel targets, including the
+// ones in (collapsed) rows and library panels, as well as the ones within templating variable queries. panel is the
+// title of the closest enclosing panel.
+func collectDashboardQueries(node interface{}, panel string) []dashboardQuery {
+	var queries []dashboardQuery
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if targets, ok := v["targets"].([]interface{}); ok {
+			if title, ok := v["title"].(string); ok {
+				panel = title
+			}
+			for _, target := range targets {
+				if t, ok := target.(map[string]interface{}); ok {
+					if expr, ok := t["expr"].(string); ok && strings.TrimSpace(expr) != "" {
+						queries = append(queries, dashboardQuery{expr: expr, panel: panel})
+					}
+				}
+			}
+		}
+		if v["type"] == "query" {
+			if query := templatingQuery(v["query"]); query != "" {
+				name, _ := v["name"].(string)
+				queries = append(queries, dashboardQuery{expr: query, panel: "$" + name})
+			}
+		}
+		for key, value := range v {
+			if key == "targets" {
+				continue
+			}
+			queries = append(queries, collectDashboardQueries(value, panel)...)
+		}
+	case []interface{}:
+		for _, value := range v {
+			queries = append(queries, collectDashboardQueries(value, panel)...)
+		}
+	}
+
+	return queries
+}
+
+// templatingQuery returns the PromQL expression behind a templating variable query, if any.
+func templatingQuery(query interface{}) string {
+	var q string
+	switch v := query.(type) {
+	case string:
+		q = v
+	case map[string]interface{}:
+		q, _ = v["query"].(string)
+	}
+	if matches := dashboardLabelValuesRegex.FindStringSubmatch(q); matches != nil {
+		// label_values(label) does not reference any metric.
+		i := strings.LastIndex(matches[1], ",")
+		if i < 0 {
+			return ""
+		}
+
+		return matches[1][:i]
+	}
+	if matches := dashboardQueryResultRegex.FindStringSubmatch(q); matches != nil {
+		return matches[1]
+	}
+
+	// metrics(regex) and label_names() do not reference any particular metric.
+	if strings.HasPrefix(strings.TrimSpace(q), "metrics(") || strings.HasPrefix(strings.TrimSpace(q), "label_names(") {
+		return ""
+	}
+
+	return q
+}
+
+// dashboardQueryContext is a bracketed part of a query that a variable may occur within, i.e., the arguments of a
+// function call or an aggregation named name, or a range selector or label matchers, named after their opening bracket.
+type dashboardQueryContext struct {
+	name string
+	arg  int
+}
+
+// interpolateDashboardVariables replaces Grafana variables within the query so that it parses as PromQL. Variables
+// within range selectors, subqueries and offsets are replaced by a duration, the ones standing for a scalar by a number,
+// and all others by a placeholder.
+func interpolateDashboardVariables(query string) string {
+	query = dashboardVariableRegex.ReplaceAllStringFunc(query, func(variable string) string {
+		if strings.HasPrefix(variable, "[[") {
+			return "$" + strings.Split(strings.Trim(variable, "[]"), ":")[0]
+		}
+
+		return variable
+	})
+
+	// Walk the query, keeping track of the brackets and the arguments that every variable occurs within.
+	var b strings.Builder
+	var contexts []dashboardQueryContext
+	var aggregation, previous string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := closingQuote(query, i)
+			b.WriteString(dashboardVariableRegex.ReplaceAllString(query[i:end], dashboardVariablePlaceholder))
+			i = end
+			previous = "string"
+
+			continue
+		case c == '$':
+			if loc := dashboardVariableRegex.FindStringIndex(query[i:]); loc != nil && loc[0] == 0 {
+				var current *dashboardQueryContext
+				if len(contexts) > 0 {
+					current = &contexts[len(contexts)-1]
+				}
+				b.WriteString(dashboardVariableSubstitute(current, previous))
+				i += loc[1]
+				previous = "variable"
+
+				continue
+			}
+		case isIdentifierStart(c):
+			j := i + 1
+			for j < len(query) && isIdentifierChar(query[j]) {
+				j++
+			}
+			identifier := query[i:j]
+			b.WriteString(identifier)
+			i = j
+			previous = strings.ToLower(identifier)
+
+			// Calls are named after the function or aggregation. The grouping clause of an aggregation may precede its
+			// arguments, in which case the aggregation is remembered until the arguments open.
+			k := j
+			for k < len(query) && unicode.IsSpace(rune(query[k])) {
+				k++
+			}
+			grouping := isGrouping(previous) || (len(contexts) > 0 && isGrouping(contexts[len(contexts)-1].name))
+			switch {
+			case k < len(query) && query[k] == '(':
+				name := identifier
+				if isGrouping(previous) {
+					name = previous
+				}
+				contexts = append(contexts, dashboardQueryContext{name: name})
+				b.WriteString(query[j : k+1])
+				i = k + 1
+				previous = "("
+			case dashboardScalarAggregations.Has(previous):
+				aggregation = previous
+			case !grouping:
+				aggregation = ""
+			}
+
+			continue
+		case c == '(':
+			contexts = append(contexts, dashboardQueryContext{name: aggregation})
+			aggregation = ""
+		case c == '[' || c == '{':
+			contexts = append(contexts, dashboardQueryContext{name: string(c)})
+		case c == ')' || c == ']' || c == '}':
+			if len(contexts) > 0 {
+				contexts = contexts[:len(contexts)-1]
+			}
+		case c == ',':
+			if len(contexts) > 0 {
+				contexts[len(contexts)-1].arg++
+			}
+		}
+		if !unicode.IsSpace(rune(c)) {
+			previous = string(c)
+		}
+		b.WriteByte(c)
+		i++
+	}
+
+	return b.String()
+}
+
+// dashboardVariableSubstitute returns what a variable is replaced by, based on the context it occurs within, and the
+// token preceding it.
+func dashboardVariableSubstitute(current *dashboardQueryContext, previous string) string {
+	switch {
+	case previous == "offset":
+		return dashboardDurationPlaceholder
+	case previous == "@":
+		return dashboardScalarPlaceholder
+	case current == nil:
+		return dashboardVariablePlaceholder
+	case current.name == "[":
+		return dashboardDurationPlaceholder
+	case isScalarArgument(current.name, current.arg):
+		return dashboardScalarPlaceholder
+	}
+
+	return dashboardVariablePlaceholder
+}
+
+// isScalarArgument returns true if the arg-th argument of the function or aggregation named name is a scalar.
+func isScalarArgument(name string, arg int) bool {
+	if dashboardScalarAggregations.Has(strings.ToLower(name)) {
+		return arg == 0
+	}
+	f, ok := parser.Functions[name]
+	if !ok || len(f.ArgTypes) == 0 {
+		return false
+	}
+
+	// Variadic functions repeat, or optionally take, their last argument.
+	if arg >= len(f.ArgTypes) {
+		if f.Variadic == 0 {
+			return false
+		}
+		arg = len(f.ArgTypes) - 1
+	}
+
+	return f.ArgTypes[arg] == parser.ValueTypeScalar
+}
+
+// isGrouping returns true if the keyword starts the grouping clause of an aggregation.
+func isGrouping(keyword string) bool {
+	return keyword == "by" || keyword == "without"
+}
+
+// closingQuote returns the index right after the string literal that starts at i, or the end of the query if it is
+// not terminated.
+func closingQuote(query string, i int) int {
+	quote := query[i]
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1
+		}
+	}
+
+	return len(query)
+}
+
+// isIdentifierStart returns true if c may start a PromQL identifier, i.e., a metric, label, function or keyword.
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isIdentifierChar returns true if c may occur within a PromQL identifier.
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,133 @@
+package profiles
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestInterpolateDashboardVariables(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: `rate(node_cpu_seconds_total{instance=~"$instance", mode!="idle"}[$__rate_interval])`,
+			want:  []string{"node_cpu_seconds_total"},
+		},
+		{
+			query: `topk($topn, sum by (instance) (up))`,
+			want:  []string{"up"},
+		},
+		{
+			query: `bottomk by (job) ([[topn]], up)`,
+			want:  []string{"up"},
+		},
+		{
+			query: `quantile(${quantile}, rate(apiserver_request_total[$interval:$resolution]))`,
+			want:  []string{"apiserver_request_total"},
+		},
+		{
+			query: `histogram_quantile($quantile, sum by (le) (rate(etcd_disk_wal_fsync_duration_seconds_bucket[5m])))`,
+			want:  []string{"etcd_disk_wal_fsync_duration_seconds_bucket"},
+		},
+		{
+			query: `round(node_load1, $precision) > $threshold`,
+			want:  []string{"node_load1"},
+		},
+		{
+			query: `node_memory_MemAvailable_bytes @ ${__to:date:seconds} offset $offset`,
+			want:  []string{"node_memory_MemAvailable_bytes"},
+		},
+		{
+			query: `label_replace(up{job="$job"}, "instance", "$1", "pod", "(.+)")`,
+			want:  []string{"up"},
+		},
+		{
+			query: `${metric}_total{job="$job"} / on (job) group_left kube_pod_info`,
+			want:  []string{"kube_pod_info"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			t.Parallel()
+
+			interpolated := interpolateDashboardVariables(tc.query)
+			expr, err := parser.ParseExpr(interpolated)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", interpolated, err)
+			}
+			var got []string
+			for _, metric := range sets.List(extractMetricsFromExpr(expr)) {
+				if !strings.Contains(metric, dashboardVariablePlaceholder) {
+					got = append(got, metric)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected metrics %v, got %v from %q", tc.want, got, interpolated)
+			}
+		})
+	}
+}
+
+func TestTemplatingQuery(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		query interface{}
+		want  string
+	}{
+		{query: `label_values(node_uname_info{job="node-exporter"}, instance)`, want: `node_uname_info{job="node-exporter"}`},
+		{query: `label_values(instance)`},
+		{query: `query_result(topk(5, up))`, want: `topk(5, up)`},
+		{query: `metrics(node_.+)`},
+		{query: `label_names()`},
+		{query: `up{job="node-exporter"}`, want: `up{job="node-exporter"}`},
+		{query: map[string]interface{}{"query": `label_values(up, job)`, "refId": "A"}, want: `up`},
+	} {
+		if got := templatingQuery(tc.query); got != tc.want {
+			t.Errorf("expected %q for %v, got %q", tc.want, tc.query, got)
+		}
+	}
+}
+
+func TestExtractMetricsFromDashboards(t *testing.T) {
+	t.Parallel()
+
+	nodes := filepath.Join("testdata", "dashboards", "nodes.json")
+	configMaps := filepath.Join("testdata", "dashboards", "configmaps.yaml")
+	provenance, err := extractMetricsFromDashboards([]string{nodes, configMaps}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"node_cpu_seconds_total":                nodes + ": Nodes/CPU",
+		"node_memory_MemAvailable_bytes":        nodes + ": Nodes/Memory",
+		"node_uname_info":                       nodes + ": Nodes/$instance",
+		"etcd_server_has_leader":                configMaps + ": etcd/$cluster",
+		"etcd_server_leader_changes_seen_total": configMaps + ": etcd/Leader changes",
+	}
+	got := map[string]string{}
+	for metric, metricProvenance := range provenance {
+		for _, p := range metricProvenance {
+			got[metric] = p.Location + ": " + p.Dashboard + "/" + p.Panel
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestLoadDashboardsInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := loadDashboards(filepath.Join("testdata", "dashboards", "missing.json")); err == nil {
+		t.Error("expected an error loading a missing dashboard")
+	}
+}
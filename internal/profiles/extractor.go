@@ -0,0 +1,408 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// ExtractRequest is the request to extract the metrics that a profile requires.
+type ExtractRequest struct {
+
+	// Sources define the metrics that the profile requires. The ones the profile does not list are ignored.
+	Sources []MetricSource
+
+	// Lister, if set, lists the monitors that have opted-in to the default profile, to generate their profile-specific
+	// counterparts and project the savings.
+	Lister MonitorLister
+
+	// OutputCardinality evaluates the cardinality of every extracted metric.
+	OutputCardinality bool
+
+	// LabelCardinality breaks every extracted metric down by label, and suggests the labels to drop.
+	LabelCardinality bool
+
+	// Savings projects the savings of the extracted metrics over the full scrape. Requires the Lister.
+	Savings bool
+}
+
+// ExtractResult is the result of an extraction, which the caller renders.
+type ExtractResult struct {
+
+	// Report is the extraction report, along with the provenance of every extracted metric.
+	Report *report.Report
+
+	// RelabelConfig is the relabel config that only keeps the extracted metrics.
+	RelabelConfig string
+
+	// LabelDropConfig is the relabel config that drops the labels suggested within the report, if any.
+	LabelDropConfig string
+
+	// Monitors are the profile-specific counterparts of the monitors that have opted-in to the default profile, as YAML
+	// documents. Only generated if the request has a Lister.
+	Monitors []string
+
+	// Savings is the savings report, if requested.
+	Savings *report.Report
+}
+
+// profileExtractor estimates the metrics needed to implement a profile from the sources it lists.
+type profileExtractor struct {
+	profile *Profile
+}
+
+func (g *profileExtractor) Extract(ctx context.Context, c *client.Client, request ExtractRequest) (*ExtractResult, error) {
+
+	// There is nothing to extract for the default profile.
+	if g.profile.IsDefault() {
+		return nil, fmt.Errorf("cannot extract profile %s: %w", g.profile.Name, errDefaultProfile)
+	}
+	klog.V(1).Infof("extracting profile %s: %s", g.profile.Name, g.profile.Description)
+
+	sourced, usage, err := g.source(ctx, c, request.Sources)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExtractResult{Report: report.New(report.KindExtraction, string(g.profile.Name))}
+	result.Report.RuleDependencies = sourced.RuleDependencies
+
+	// metrics contains all extracted metrics.
+	metrics := sourced.Metrics()
+	err = g.buildResult(ctx, c, request, result, sourced, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Project the savings of the extracted metrics over the full scrape, if requested.
+	if request.Savings && request.Lister != nil && c == nil {
+		return nil, fmt.Errorf("failed to project savings: %w", errNoPrometheus)
+	} else if request.Savings && request.Lister != nil {
+		endpoints, err := extractedSavingsEndpoints(ctx, request.Lister, metrics)
+		if err != nil {
+			return nil, err
+		}
+		result.Savings, err = savingsReport(ctx, c, g.profile.Name, endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to project savings: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Explain returns the explanation report of the metric, i.e., where the sources listed by the profile found it, down to
+// the recording rules that lead from a rule to the metric.
+func (g *profileExtractor) Explain(ctx context.Context, c *client.Client, sources []MetricSource, metric string) (*report.Report, error) {
+	sourced, _, err := g.source(ctx, c, sources)
+	if err != nil {
+		return nil, err
+	}
+	r := report.New(report.KindExplanation, string(g.profile.Name))
+	m := report.Metric{Name: metric, Provenance: sourced.Provenance[metric]}
+	if len(m.Provenance) == 0 {
+		m.Error = ErrNotExtracted
+	}
+	r.Metrics = append(r.Metrics, m)
+
+	return r, nil
+}
+
+// source returns the metrics that the sources listed by the profile require, along with the labels they reference.
+func (g *profileExtractor) source(ctx context.Context, c *client.Client, sources []MetricSource) (*SourcedMetrics, *labelUsage, error) {
+	all := NewSourcedMetrics()
+
+	// usage tracks the labels that the sources reference, to suggest dropping the rest.
+	usage := newLabelUsage()
+	for _, source := range sources {
+
+		// Ignore the sources that do not define the metrics the profile requires.
+		if !g.profile.uses(source.Source()) {
+			klog.Warningf("profile %s does not source metrics from %s, ignoring it", g.profile.Name, source.Source())
+
+			continue
+		}
+		sourced, err := source.Metrics(ctx, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		all.merge(sourced.Provenance)
+		all.RuleDependencies = append(all.RuleDependencies, sourced.RuleDependencies...)
+		if sourced.usage == nil {
+			usage.addAll(sourced.Metrics())
+		} else {
+			usage.merge(sourced.usage)
+		}
+	}
+
+	return all, usage, nil
+}
+
+// extractMetricsFromAllowListFile returns the metrics within the allow-list file. The labels that the allow-list
+// references for them are marked within usage, if set, or all of them, if it references none.
+func extractMetricsFromAllowListFile(allowlistFile string, usage *labelUsage) (sets.Set[string], error) {
+	buffer, err := os.ReadFile(allowlistFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allow-list file: %w", err)
+	}
+	type Data struct {
+		Metrics []string `json:"metrics"`
+		Labels  []string `json:"labels"`
+	}
+	data := Data{}
+	err = yaml.Unmarshal(buffer, &data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal allow-list file: %w", err)
+	}
+	allowListedMetrics := sets.Set[string]{}
+	for _, metric := range data.Metrics {
+		allowListedMetrics.Insert(metric)
+	}
+	if len(data.Labels) > 0 {
+		usage.addLabels(allowListedMetrics, data.Labels...)
+	} else {
+		usage.addAll(allowListedMetrics)
+	}
+
+	return allowListedMetrics, nil
+}
+
+// extractMetricsFromRuleFiles returns the scraped metrics that the rules within the rule files depend on, following
+// names recorded by recording rules back to the metrics they are recorded from, along with the rules that depend on
+// them. Recording rules whose inputs are absent from the Prometheus instance, as well as dependency cycles between
+// recording rules, are returned as well. The labels that the rules reference are marked within usage, if set.
+func extractMetricsFromRuleFiles(ctx context.Context, c *client.Client, ruleFiles []string, usage *labelUsage) (map[string][]report.Provenance, []report.RuleDependency, error) {
+	g, err := buildRuleGraph(ruleFiles, usage)
+	if err != nil {
+		return nil, nil, err
+	}
+	cycles := g.resolve()
+
+	// Fetch all metric names known to the Prometheus instance to determine the missing inputs, if there is one.
+	var missing []missingInput
+	if c == nil {
+		klog.V(1).Info("no Prometheus instance to fetch metric names from, skipping missing inputs check")
+	} else if knownMetrics, _, err := c.LabelValues(ctx, model.MetricNameLabel, nil, time.Time{}, time.Time{}); err != nil {
+		klog.Warningf("failed to fetch metric names, skipping missing inputs check: %v", err)
+	} else {
+		known := sets.Set[string]{}
+		for _, m := range knownMetrics {
+			known.Insert(string(m))
+		}
+		missing = g.missingInputs(known)
+	}
+
+	var ruleDependencies []report.RuleDependency
+	for _, m := range missing {
+		ruleDependencies = append(ruleDependencies, report.RuleDependency{
+			RecordingRule: m.rule.name,
+			Group:         m.rule.group,
+			File:          m.rule.file,
+			Metrics:       m.metrics,
+			Error:         ErrMissingInput,
+		})
+	}
+	for _, cycle := range cycles {
+		ruleDependencies = append(ruleDependencies, report.RuleDependency{
+			RecordingRule: cycle[0],
+			Metrics:       cycle,
+			Error:         ErrCycle,
+		})
+	}
+
+	return g.provenance(), ruleDependencies, nil
+}
+
+// extractProfileFromTargets returns the metrics exposed by all targets that match the series selector. All match
+// types are supported, and are evaluated against the label sets of the targets discovered by the Prometheus instance.
+// Matchers on the metric name, if any, filter the metrics exposed by the matching targets.
+func extractProfileFromTargets(ctx context.Context, c *client.Client, targets string) (sets.Set[string], error) {
+	if c == nil {
+		return nil, errNoPrometheus
+	}
+	matchers, err := parser.ParseMetricSelector(targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse targets: %w", err)
+	}
+	var targetMatchers, nameMatchers []*labels.Matcher
+	for _, matcher := range matchers {
+		if matcher.Name == model.MetricNameLabel {
+			nameMatchers = append(nameMatchers, matcher)
+		} else {
+			targetMatchers = append(targetMatchers, matcher)
+		}
+	}
+	targetsResult, err := c.Targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch targets: %w", err)
+	}
+
+	// Look up the metadata for every matching target, identified by its job and instance alone, since the client falls
+	// back to the series API for backends without the targets metadata API, and the series may not carry the other
+	// target labels.
+	metrics := sets.Set[string]{}
+	seen := sets.Set[string]{}
+	for _, target := range targetsResult.Active {
+		if !matchesLabelSet(targetMatchers, target.Labels) {
+			continue
+		}
+		matchTarget := targetKey(string(target.Labels[model.JobLabel]), string(target.Labels[model.InstanceLabel]))
+		if seen.Has(matchTarget) {
+			continue
+		}
+		seen.Insert(matchTarget)
+		targetsMetadata, err := c.TargetsMetadata(ctx, matchTarget, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch targets metadata for %s: %w", matchTarget, err)
+		}
+		for _, data := range targetsMetadata {
+			m := data.Metric
+			if matchesMetricName(nameMatchers, m) {
+				metrics.Insert(m)
+			}
+		}
+	}
+	if len(seen) == 0 {
+		klog.Warningf("no targets matched %s", targets)
+	}
+
+	return metrics, nil
+}
+
+// matchesLabelSet returns true if the label set satisfies all matchers. Absent labels are treated as empty.
+func matchesLabelSet(matchers []*labels.Matcher, ls model.LabelSet) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(string(ls[model.LabelName(matcher.Name)])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesMetricName returns true if the metric name satisfies all matchers.
+func matchesMetricName(matchers []*labels.Matcher, metric string) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(metric) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildResult fills the report of the extracted metrics, along with their provenance, and their cardinality statistics
+// and label breakdown if requested, as well as the relabel config and monitors that keep them.
+func (g *profileExtractor) buildResult(
+	ctx context.Context,
+	c *client.Client,
+	request ExtractRequest,
+	result *ExtractResult,
+	sourced *SourcedMetrics,
+	usage *labelUsage,
+) error {
+	r := result.Report
+	metrics := sourced.Metrics()
+	if (request.OutputCardinality || request.LabelCardinality) && c == nil {
+		return fmt.Errorf("failed to evaluate cardinalities: %w", errNoPrometheus)
+	}
+	if request.OutputCardinality {
+		failed, absentNow := 0, 0
+		for _, cardinalityStat := range c.EvaluateCardinalities(ctx, &metrics) {
+			if cardinalityStat.Err != nil {
+				failed++
+				r.Metrics = append(r.Metrics, report.Metric{Name: cardinalityStat.Metric, Error: cardinalityStat.Err.Error()})
+
+				continue
+			}
+			cardinality := cardinalityStat.Value
+			metric := report.Metric{Name: cardinalityStat.Metric, Cardinality: &cardinality, AbsentNow: cardinalityStat.AbsentNow()}
+			if cardinalityStat.Range != nil {
+				metric.Range = &report.CardinalityRange{
+					Min: cardinalityStat.Range.Min,
+					Avg: cardinalityStat.Range.Avg,
+					Max: cardinalityStat.Range.Max,
+					P95: cardinalityStat.Range.P95,
+				}
+			}
+			if metric.AbsentNow {
+				absentNow++
+			}
+			r.Metrics = append(r.Metrics, metric)
+		}
+		if failed > 0 {
+			klog.Warningf("failed to evaluate the cardinality of %d metrics", failed)
+		}
+
+		// Such metrics are kept by the relabel config regardless, but only by the generated monitors whose targets still
+		// expose them.
+		if absentNow > 0 {
+			klog.Warningf("%d metrics had series within the lookback window, but have none now, they are kept by the relabel config, and by the generated monitors whose targets still expose them", absentNow)
+		}
+	} else {
+		for _, metric := range sets.List(metrics) {
+			r.Metrics = append(r.Metrics, report.Metric{Name: metric})
+		}
+	}
+
+	for i := range r.Metrics {
+		r.Metrics[i].Provenance = sourced.Provenance[r.Metrics[i].Name]
+	}
+
+	// Break the extracted metrics down by label, and suggest dropping the labels that nothing references.
+	var err error
+	if request.LabelCardinality {
+		result.LabelDropConfig, err = breakDownLabels(ctx, c, r, metrics, usage)
+		if err != nil {
+			return fmt.Errorf("failed to break down label cardinality: %w", err)
+		}
+	}
+
+	// The relabel config that only keeps the extracted metrics.
+	result.RelabelConfig, err = toRelabelConfig(metrics)
+	if err != nil {
+		return err
+	}
+
+	// The profile-specific counterparts of the default monitors, that only keep the extracted metrics.
+	if request.Lister == nil {
+		klog.Info("no monitors to generate profile-specific counterparts for, KUBECONFIG or -manifests-dir is not set")
+
+		return nil
+	}
+	if c == nil {
+		klog.Info("not generating profile-specific monitors, the metrics exposed by their targets are looked up from a Prometheus instance")
+
+		return nil
+	}
+	result.Monitors, err = generateProfileMonitors(ctx, c, request.Lister, g.profile, metrics)
+	if err != nil {
+		return fmt.Errorf("failed to generate monitors: %w", err)
+	}
+
+	return nil
+}
+
+// toRelabelConfig returns the relabel config that only keeps the given metrics, as a YAML document.
+func toRelabelConfig(metrics sets.Set[string]) (string, error) {
+	relabelConfig, err := keepMetricsRelabelConfig(metrics)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate relabel config: %w", err)
+	}
+	relabelConfigBytes, err := yaml.Marshal(relabelConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal relabel config: %w", err)
+	}
+
+	return string(relabelConfigBytes), nil
+}
@@ -0,0 +1,259 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// targetLabels identify the target a series was scraped from, and are never suggested to be dropped.
+var targetLabels = sets.New[string](model.JobLabel, model.InstanceLabel)
+
+// labelUsage tracks the labels of every metric that the rules, dashboards, telemetry config and allow-list reference.
+type labelUsage struct {
+
+	// labels has the labels referenced for every metric.
+	labels map[string]sets.Set[string]
+
+	// all has the metrics whose labels are all referenced, for eg., by expressions that do not aggregate them away, or
+	// by sources that keep the series as is.
+	all sets.Set[string]
+}
+
+func newLabelUsage() *labelUsage {
+	return &labelUsage{
+		labels: map[string]sets.Set[string]{},
+		all:    sets.Set[string]{},
+	}
+}
+
+// uses returns true if the label of the metric is referenced.
+func (u *labelUsage) uses(metric, label string) bool {
+	return targetLabels.Has(label) || u.all.Has(metric) || u.labels[metric].Has(label)
+}
+
+// addAll marks all labels of the metrics as referenced.
+func (u *labelUsage) addAll(metrics sets.Set[string]) {
+	if u == nil {
+		return
+	}
+	u.all = u.all.Union(metrics)
+}
+
+// addLabels marks the labels of the metrics as referenced.
+func (u *labelUsage) addLabels(metrics sets.Set[string], labels ...string) {
+	if u == nil {
+		return
+	}
+	for metric := range metrics {
+		if _, ok := u.labels[metric]; !ok {
+			u.labels[metric] = sets.Set[string]{}
+		}
+		u.labels[metric].Insert(labels...)
+	}
+}
+
+// merge marks the labels that other references as referenced.
+func (u *labelUsage) merge(other *labelUsage) {
+	u.all = u.all.Union(other.all)
+	for metric, labels := range other.labels {
+		u.addLabels(sets.New(metric), sets.List(labels)...)
+	}
+}
+
+// addExpr marks the labels that the expression references for every metric selected within it. A label is referenced
+// if it is matched on, grouped by, used for vector matching, or read by a function, anywhere along the path from the
+// expression to the selector. The labels of a selector that is not aggregated away by any of its ancestors end up in
+// the result of the expression (for eg., the labels of an alert, or the legend of a panel), and are thus all referenced,
+// as are the ones that are matched on as a whole by a binary operation without an on clause.
+func (u *labelUsage) addExpr(expr parser.Expr) {
+	if u == nil {
+		return
+	}
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok || vs.Name == "" {
+			return nil
+		}
+		referenced := sets.Set[string]{}
+		for _, matcher := range vs.LabelMatchers {
+			if matcher.Name != model.MetricNameLabel {
+				referenced.Insert(matcher.Name)
+			}
+		}
+		aggregated, all := false, false
+		for _, ancestor := range path {
+			switch n := ancestor.(type) {
+			case *parser.AggregateExpr:
+				referenced.Insert(n.Grouping...)
+
+				// These return the input series as is.
+				if n.Op == parser.TOPK || n.Op == parser.BOTTOMK {
+					continue
+				}
+				if !n.Without {
+					aggregated = true
+				}
+			case *parser.BinaryExpr:
+				if n.VectorMatching == nil {
+					continue
+				}
+				referenced.Insert(n.VectorMatching.MatchingLabels...)
+				referenced.Insert(n.VectorMatching.Include...)
+				if !n.VectorMatching.On {
+					all = true
+				}
+			case *parser.Call:
+				referenced.Insert(labelArgs(n)...)
+			}
+		}
+
+		// Labels named after unresolved dashboard variables may be any of them.
+		for label := range referenced {
+			if strings.Contains(label, dashboardVariablePlaceholder) {
+				all = true
+			}
+		}
+		if all || !aggregated {
+			u.all.Insert(vs.Name)
+		} else {
+			u.addLabels(sets.New(vs.Name), sets.List(referenced)...)
+		}
+
+		return nil
+	})
+}
+
+// labelArgs returns the labels that the function call reads, besides the ones of its input series.
+func labelArgs(call *parser.Call) []string {
+	var labels []string
+	switch call.Func.Name {
+	case "histogram_quantile":
+		labels = append(labels, model.BucketLabel)
+	case "label_replace":
+		// label_replace(v, dst_label, replacement, src_label, regex)
+		labels = append(labels, stringArgs(call.Args[1:2])...)
+		labels = append(labels, stringArgs(call.Args[3:4])...)
+	case "label_join":
+		// label_join(v, dst_label, separator, src_label_1, src_label_2, ...)
+		labels = append(labels, stringArgs(call.Args[1:2])...)
+		labels = append(labels, stringArgs(call.Args[3:])...)
+	}
+
+	return labels
+}
+
+// stringArgs returns the values of the string literals among the arguments.
+func stringArgs(args parser.Expressions) []string {
+	var values []string
+	for _, arg := range args {
+		for {
+			paren, ok := arg.(*parser.ParenExpr)
+			if !ok {
+				break
+			}
+			arg = paren.Expr
+		}
+		if s, ok := arg.(*parser.StringLiteral); ok {
+			values = append(values, s.Val)
+		}
+	}
+
+	return values
+}
+
+// breakDownLabels breaks every extracted metric within the report down by label, and suggests dropping the labels
+// that nothing references on any of the extracted metrics that carry them, as long as their series remain unique
+// without them. The suggested labels are returned as a labeldrop relabel config, as it applies to all metrics of an
+// endpoint, or an empty one if there are none.
+func breakDownLabels(ctx context.Context, c *client.Client, r *report.Report, metrics sets.Set[string], usage *labelUsage) (string, error) {
+	rows := map[string]*report.Metric{}
+	for i := range r.Metrics {
+		rows[r.Metrics[i].Name] = &r.Metrics[i]
+	}
+
+	// candidates has the labels that are not referenced on any of the metrics that carry them.
+	candidates, referenced := sets.Set[string]{}, sets.Set[string]{}
+	failed := 0
+	cardinalities := c.EvaluateLabelCardinalities(ctx, sets.List(metrics))
+	for _, cardinality := range cardinalities {
+		row := rows[cardinality.Metric]
+		if cardinality.Err != nil {
+			failed++
+			if row.Error == "" {
+				row.Error = cardinality.Err.Error()
+			}
+
+			continue
+		}
+		for _, label := range sets.List(sets.KeySet(cardinality.Labels)) {
+			uses := usage.uses(cardinality.Metric, label)
+			row.Labels = append(row.Labels, report.Label{
+				Name:        label,
+				Cardinality: cardinality.Labels[label],
+				Referenced:  uses,
+			})
+			if uses {
+				referenced.Insert(label)
+			} else {
+				candidates.Insert(label)
+			}
+		}
+	}
+	for _, row := range rows {
+		sort.SliceStable(row.Labels, func(i, j int) bool {
+			return row.Labels[i].Cardinality > row.Labels[j].Cardinality
+		})
+	}
+	if failed > 0 {
+		klog.Warningf("failed to break down %d metrics by label, not suggesting any labels to drop", failed)
+
+		return "", nil
+	}
+	candidates = candidates.Difference(referenced)
+
+	// Keep the labels that are needed to tell the series of any of the metrics apart.
+	drops := map[string][]string{}
+	for _, cardinality := range cardinalities {
+		drop := candidates.Intersection(sets.KeySet(cardinality.Labels))
+		if drop.Len() > 0 {
+			drops[cardinality.Metric] = sets.List(drop)
+		}
+	}
+	for metric, collides := range c.EvaluateLabelDropCollisions(ctx, drops) {
+		if collides {
+			klog.V(1).Infof("not suggesting to drop %v, since the series of %s would collide", drops[metric], metric)
+			candidates = candidates.Difference(sets.New(drops[metric]...))
+		}
+	}
+	if candidates.Len() == 0 {
+		return "", nil
+	}
+	r.LabelDrops = sets.List(candidates)
+
+	return toLabelDropConfig(fmt.Sprintf("(%s)", strings.Join(r.LabelDrops, "|")))
+}
+
+func toLabelDropConfig(labelsRegex string) (string, error) {
+	relabelConfig := monitoringv1.RelabelConfig{
+		Regex:  labelsRegex,
+		Action: "labeldrop",
+	}
+	relabelConfigBytes, err := yaml.Marshal(relabelConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal labeldrop config: %w", err)
+	}
+
+	return string(relabelConfigBytes), nil
+}
@@ -0,0 +1,246 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// MetricSource is a source of the metrics that a profile requires.
+type MetricSource interface {
+
+	// Source returns the kind of the source, which profiles list to define their required metrics.
+	Source() Source
+
+	// Metrics returns the metrics that the source requires, along with their provenance.
+	Metrics(ctx context.Context, c *client.Client) (*SourcedMetrics, error)
+}
+
+// SourcedMetrics are the metrics that a source requires, along with their provenance.
+type SourcedMetrics struct {
+
+	// Provenance has where every metric was found.
+	Provenance map[string][]report.Provenance
+
+	// RuleDependencies has the recording rules whose inputs are absent, as well as the cycles between them.
+	RuleDependencies []report.RuleDependency
+
+	// usage tracks the labels that the source references. If nil, all labels of the metrics are deemed referenced.
+	usage *labelUsage
+}
+
+// NewSourcedMetrics returns an empty set of sourced metrics, all labels of which are deemed referenced.
+func NewSourcedMetrics() *SourcedMetrics {
+	return &SourcedMetrics{Provenance: map[string][]report.Provenance{}}
+}
+
+// Add adds the metric, found at the given provenance.
+func (m *SourcedMetrics) Add(metric string, provenance report.Provenance) {
+	m.Provenance[metric] = append(m.Provenance[metric], provenance)
+}
+
+// Metrics returns the set of sourced metrics.
+func (m *SourcedMetrics) Metrics() sets.Set[string] {
+	return sets.KeySet(m.Provenance)
+}
+
+// addAll adds all metrics, found at the given provenance.
+func (m *SourcedMetrics) addAll(metrics sets.Set[string], provenance report.Provenance) {
+	for _, metric := range sets.List(metrics) {
+		m.Add(metric, provenance)
+	}
+}
+
+// merge adds all metrics within provenance, found at their respective provenance.
+func (m *SourcedMetrics) merge(provenance map[string][]report.Provenance) {
+	for metric, p := range provenance {
+		m.Provenance[metric] = append(m.Provenance[metric], p...)
+	}
+}
+
+// allowListSource sources the metrics within an allow-list file.
+type allowListSource struct {
+	file string
+}
+
+// NewAllowListSource returns a source of the metrics within the allow-list file, which is skipped if it does not exist.
+//
+//nolint:ireturn
+func NewAllowListSource(file string) MetricSource {
+	return &allowListSource{file: file}
+}
+
+func (s *allowListSource) Source() Source {
+	return SourceAllowList
+}
+
+func (s *allowListSource) Metrics(_ context.Context, _ *client.Client) (*SourcedMetrics, error) {
+	m := NewSourcedMetrics()
+	m.usage = newLabelUsage()
+
+	// Check if allow-list file exists.
+	file, _ := filepath.Abs(filepath.Clean(s.file))
+	if stat, err := os.Stat(file); os.IsNotExist(err) || stat.IsDir() {
+		return m, nil
+	}
+	extractedMetrics, err := extractMetricsFromAllowListFile(file, m.usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metrics from allow-list file: %w", err)
+	}
+	m.addAll(extractedMetrics, report.Provenance{Source: string(SourceAllowList), Location: file})
+
+	return m, nil
+}
+
+// ruleFilesSource sources the scraped metrics that the rules within rule files depend on.
+type ruleFilesSource struct {
+	files []string
+}
+
+// NewRuleFilesSource returns a source of the scraped metrics that the rules within the rule files depend on. Rule files
+// that do not exist are skipped.
+//
+//nolint:ireturn
+func NewRuleFilesSource(files []string) MetricSource {
+	return &ruleFilesSource{files: files}
+}
+
+func (s *ruleFilesSource) Source() Source {
+	return SourceRules
+}
+
+func (s *ruleFilesSource) Metrics(ctx context.Context, c *client.Client) (*SourcedMetrics, error) {
+	m := NewSourcedMetrics()
+	m.usage = newLabelUsage()
+
+	// Check if rule files exist.
+	ruleFiles := existingFiles(s.files)
+	if len(ruleFiles) == 0 {
+		return m, nil
+	}
+
+	// Extract the scraped metrics that the rules transitively depend on.
+	provenance, ruleDependencies, err := extractMetricsFromRuleFiles(ctx, c, ruleFiles, m.usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metrics from rule files: %w", err)
+	}
+	m.merge(provenance)
+	m.RuleDependencies = ruleDependencies
+
+	return m, nil
+}
+
+// dashboardsSource sources the metrics used within Grafana dashboards.
+type dashboardsSource struct {
+	paths []string
+}
+
+// NewDashboardsSource returns a source of the metrics used within the panels and templating variables of the Grafana
+// dashboards at the given paths. Paths that do not exist are skipped.
+//
+//nolint:ireturn
+func NewDashboardsSource(paths []string) MetricSource {
+	return &dashboardsSource{paths: paths}
+}
+
+func (s *dashboardsSource) Source() Source {
+	return SourceDashboards
+}
+
+func (s *dashboardsSource) Metrics(_ context.Context, _ *client.Client) (*SourcedMetrics, error) {
+	m := NewSourcedMetrics()
+	m.usage = newLabelUsage()
+
+	// Check if dashboards exist, and extract metrics from them.
+	provenance, err := extractMetricsFromDashboards(existingFiles(s.paths), m.usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metrics from dashboards: %w", err)
+	}
+	m.merge(provenance)
+
+	return m, nil
+}
+
+// telemetrySource sources the metrics selected by the telemetry config.
+type telemetrySource struct {
+	dc        dynamic.Interface
+	file      string
+	configMap string
+}
+
+// NewTelemetrySource returns a source of the metrics selected by the telemetry config at file, or within the ConfigMap
+// (<namespace>/<name>) in the cluster that dc points to.
+//
+//nolint:ireturn
+func NewTelemetrySource(dc dynamic.Interface, file, configMap string) MetricSource {
+	return &telemetrySource{dc: dc, file: file, configMap: configMap}
+}
+
+func (s *telemetrySource) Source() Source {
+	return SourceTelemetry
+}
+
+func (s *telemetrySource) Metrics(ctx context.Context, c *client.Client) (*SourcedMetrics, error) {
+	provenance, err := extractMetricsFromTelemetryConfig(ctx, c, s.dc, s.file, s.configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metrics from telemetry config: %w", err)
+	}
+
+	// Telemetry forwards the selected series as is, so all of their labels are referenced.
+	m := NewSourcedMetrics()
+	m.merge(provenance)
+
+	return m, nil
+}
+
+// targetsSource sources the metrics exposed by the targets that match a series selector.
+type targetsSource struct {
+	selector string
+}
+
+// NewTargetsSource returns a source of the metrics exposed by all targets that match the series selector.
+//
+//nolint:ireturn
+func NewTargetsSource(selector string) MetricSource {
+	return &targetsSource{selector: selector}
+}
+
+func (s *targetsSource) Source() Source {
+	return SourceTargets
+}
+
+func (s *targetsSource) Metrics(ctx context.Context, c *client.Client) (*SourcedMetrics, error) {
+	extractedMetrics, err := extractProfileFromTargets(ctx, c, s.selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metrics from targets: %w", err)
+	}
+
+	// Nothing is known about how the metrics exposed by the targets are used.
+	m := NewSourcedMetrics()
+	m.addAll(extractedMetrics, report.Provenance{Source: string(SourceTargets), Location: s.selector})
+
+	return m, nil
+}
+
+// existingFiles returns the absolute paths of the given files, leaving out the ones that do not exist.
+func existingFiles(files []string) []string {
+	var existing []string
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		f, _ = filepath.Abs(filepath.Clean(f))
+		if stat, err := os.Stat(f); !os.IsNotExist(err) && !stat.IsDir() {
+			existing = append(existing, f)
+		}
+	}
+
+	return existing
+}
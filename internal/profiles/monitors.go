@@ -0,0 +1,246 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/client"
+)
+
+// scrapePoolMetrics returns the series names exposed by the targets of every scrape pool, looked up from the targets
+// metadata keyed by the job and instance of each target.
+func scrapePoolMetrics(ctx context.Context, c *client.Client) (map[string]sets.Set[string], error) {
+	targetsResult, err := c.Targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch targets: %w", err)
+	}
+	targetsMetadata, err := c.TargetsMetadata(ctx, "", "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch targets metadata: %w", err)
+	}
+
+	// Several scrape pools may discover the same target.
+	metrics := map[string]sets.Set[string]{}
+	scrapePools := map[string][]string{}
+	for _, target := range targetsResult.Active {
+		metrics[target.ScrapePool] = sets.Set[string]{}
+		key := targetKey(string(target.Labels[model.JobLabel]), string(target.Labels[model.InstanceLabel]))
+		scrapePools[key] = append(scrapePools[key], target.ScrapePool)
+	}
+	for _, data := range targetsMetadata {
+		for _, scrapePool := range scrapePools[targetKey(data.Target[model.JobLabel], data.Target[model.InstanceLabel])] {
+			metrics[scrapePool].Insert(seriesNames(data)...)
+		}
+	}
+
+	return metrics, nil
+}
+
+// targetKey identifies a target by its job and instance.
+func targetKey(job, instance string) string {
+	return model.LabelSet{
+		model.JobLabel:      model.LabelValue(job),
+		model.InstanceLabel: model.LabelValue(instance),
+	}.String()
+}
+
+// seriesNames returns the names of the series that the metric family exposes, since the targets metadata is keyed by the
+// family name, for eg., foo for the histogram series foo_bucket, foo_sum and foo_count.
+func seriesNames(data v1.MetricMetadata) []string {
+	family := data.Metric
+	names := []string{family}
+	switch data.Type {
+	case v1.MetricTypeHistogram:
+		names = append(names, family+"_bucket", family+"_sum", family+"_count")
+	case v1.MetricTypeGaugeHistogram:
+		names = append(names, family+"_bucket", family+"_gsum", family+"_gcount")
+	case v1.MetricTypeSummary:
+		names = append(names, family+"_sum", family+"_count")
+	case v1.MetricTypeCounter:
+		if !strings.HasSuffix(family, "_total") {
+			names = append(names, family+"_total")
+		}
+	case v1.MetricTypeInfo:
+		if !strings.HasSuffix(family, "_info") {
+			names = append(names, family+"_info")
+		}
+	case v1.MetricTypeGauge, v1.MetricTypeStateset, v1.MetricTypeUnknown:
+	}
+
+	return names
+}
+
+// errNoMetricsToKeep is returned for relabel configs that would keep no metrics, since their empty regex would drop all
+// of them instead.
+var errNoMetricsToKeep = errors.New("no metrics to keep")
+
+// keepMetricsRelabelConfig returns the relabel config that only keeps the given metrics.
+func keepMetricsRelabelConfig(metrics sets.Set[string]) (*monitoringv1.RelabelConfig, error) {
+	if metrics.Len() == 0 {
+		return nil, errNoMetricsToKeep
+	}
+
+	return &monitoringv1.RelabelConfig{
+		SourceLabels: []monitoringv1.LabelName{model.MetricNameLabel},
+		Regex:        fmt.Sprintf("(%s)", strings.Join(sets.List(metrics), "|")),
+		Action:       "keep",
+	}, nil
+}
+
+// profileObjectMeta returns the metadata of the profile-specific counterpart of a monitor, named according to the
+// convention that ReportImplementationStatus checks for, and opted-in to the profile.
+func profileObjectMeta(meta metav1.ObjectMeta, profile *Profile) metav1.ObjectMeta {
+	labels := map[string]string{}
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	labels[CollectionProfileOptInLabel] = string(profile.Name)
+
+	return metav1.ObjectMeta{
+		Name:        profile.CounterpartName(meta.Name),
+		Namespace:   meta.Namespace,
+		Labels:      labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+// generateProfileMonitors returns the profile-specific counterparts of all monitors that have opted-in to the default
+// profile, as YAML documents. Every endpoint of the generated monitors only keeps the metrics out of the given ones that
+// its targets expose, and is left out if they expose none of them, as are the monitors left without any endpoints.
+func generateProfileMonitors(
+	ctx context.Context,
+	c *client.Client,
+	lister MonitorLister,
+	profile *Profile,
+	metrics sets.Set[string],
+) ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("failed to look up the metrics exposed by the targets: %w", errNoPrometheus)
+	}
+	podMonitors, serviceMonitors, err := FetchMonitorsForProfile(ctx, lister, FullCollectionProfile, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitors for profile %s: %w", FullCollectionProfile, err)
+	}
+	poolMetrics, err := scrapePoolMetrics(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []interface{}
+	for _, serviceMonitor := range serviceMonitors.Items {
+		generated := &monitoringv1.ServiceMonitor{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       monitoringv1.ServiceMonitorsKind,
+			},
+			ObjectMeta: profileObjectMeta(serviceMonitor.ObjectMeta, profile),
+			Spec:       *serviceMonitor.Spec.DeepCopy(),
+		}
+		var endpoints []monitoringv1.Endpoint
+		for i, endpoint := range generated.Spec.Endpoints {
+			scrapePool := serviceMonitorScrapePool(serviceMonitor, i)
+			relabelConfig, err := keepMetricsRelabelConfig(metrics.Intersection(poolMetrics[scrapePool]))
+			if err != nil {
+				klog.Warningf("leaving %s out of the generated monitor: %v", scrapePool, err)
+
+				continue
+			}
+			endpoint.MetricRelabelConfigs = append(endpoint.MetricRelabelConfigs, relabelConfig)
+			endpoints = append(endpoints, endpoint)
+		}
+		if len(endpoints) == 0 {
+			klog.Warningf("not generating a counterpart for servicemonitor %s/%s: %v", serviceMonitor.Namespace, serviceMonitor.Name, errNoMetricsToKeep)
+
+			continue
+		}
+		generated.Spec.Endpoints = endpoints
+		objects = append(objects, generated)
+	}
+	for _, podMonitor := range podMonitors.Items {
+		generated := &monitoringv1.PodMonitor{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: monitoringv1.SchemeGroupVersion.String(),
+				Kind:       monitoringv1.PodMonitorsKind,
+			},
+			ObjectMeta: profileObjectMeta(podMonitor.ObjectMeta, profile),
+			Spec:       *podMonitor.Spec.DeepCopy(),
+		}
+		var endpoints []monitoringv1.PodMetricsEndpoint
+		for i, endpoint := range generated.Spec.PodMetricsEndpoints {
+			scrapePool := podMonitorScrapePool(podMonitor, i)
+			relabelConfig, err := keepMetricsRelabelConfig(metrics.Intersection(poolMetrics[scrapePool]))
+			if err != nil {
+				klog.Warningf("leaving %s out of the generated monitor: %v", scrapePool, err)
+
+				continue
+			}
+			endpoint.MetricRelabelConfigs = append(endpoint.MetricRelabelConfigs, relabelConfig)
+			endpoints = append(endpoints, endpoint)
+		}
+		if len(endpoints) == 0 {
+			klog.Warningf("not generating a counterpart for podmonitor %s/%s: %v", podMonitor.Namespace, podMonitor.Name, errNoMetricsToKeep)
+
+			continue
+		}
+		generated.Spec.PodMetricsEndpoints = endpoints
+		objects = append(objects, generated)
+	}
+
+	var documents []string
+	for _, object := range objects {
+		document, err := toManifest(object)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// toManifest returns the monitor as a YAML document that may be applied as is, leaving out the fields that are only set
+// since their types are not pointers, i.e., the creation timestamp, and the empty bearer token secret of every endpoint.
+func toManifest(monitor interface{}) (string, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(monitor)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert monitor: %w", err)
+	}
+	unstructured.RemoveNestedField(object, "metadata", "creationTimestamp")
+	for _, field := range []string{"endpoints", "podMetricsEndpoints"} {
+		endpoints, _, _ := unstructured.NestedSlice(object, "spec", field)
+		for _, endpoint := range endpoints {
+			endpoint, ok := endpoint.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			secret, _, _ := unstructured.NestedStringMap(endpoint, "bearerTokenSecret")
+			if secret["name"] == "" && secret["key"] == "" {
+				delete(endpoint, "bearerTokenSecret")
+			}
+		}
+		if endpoints != nil {
+			err = unstructured.SetNestedSlice(object, endpoints, "spec", field)
+			if err != nil {
+				return "", fmt.Errorf("failed to set %s: %w", field, err)
+			}
+		}
+	}
+	b, err := yaml.Marshal(object)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal monitor: %w", err)
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,88 @@
+package profiles
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestToManifest(t *testing.T) {
+	t.Parallel()
+
+	monitor := &monitoringv1.ServiceMonitor{
+		TypeMeta:   metav1.TypeMeta{APIVersion: monitoringv1.SchemeGroupVersion.String(), Kind: monitoringv1.ServiceMonitorsKind},
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-state-metrics-minimal", Namespace: "openshift-monitoring"},
+		Spec: monitoringv1.ServiceMonitorSpec{
+			Endpoints: []monitoringv1.Endpoint{
+				{Port: "https-main"},
+				{
+					Port: "https-self",
+					BearerTokenSecret: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "kube-state-metrics-token"},
+						Key:                  "token",
+					},
+				},
+			},
+		},
+	}
+	document, err := toManifest(monitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(document, "creationTimestamp") {
+		t.Errorf("expected no creation timestamp, got:\n%s", document)
+	}
+	if got := strings.Count(document, "bearerTokenSecret"); got != 1 {
+		t.Errorf("expected only the set bearer token secret to be kept, got %d within:\n%s", got, document)
+	}
+	if !strings.Contains(document, "name: kube-state-metrics-token") {
+		t.Errorf("expected the set bearer token secret to be kept as is, got:\n%s", document)
+	}
+}
+
+func TestSeriesNames(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		metadata v1.MetricMetadata
+		want     []string
+	}{
+		{
+			metadata: v1.MetricMetadata{Metric: "etcd_disk_wal_fsync_duration_seconds", Type: v1.MetricTypeHistogram},
+			want: []string{
+				"etcd_disk_wal_fsync_duration_seconds",
+				"etcd_disk_wal_fsync_duration_seconds_bucket",
+				"etcd_disk_wal_fsync_duration_seconds_count",
+				"etcd_disk_wal_fsync_duration_seconds_sum",
+			},
+		},
+		{
+			metadata: v1.MetricMetadata{Metric: "go_gc_duration_seconds", Type: v1.MetricTypeSummary},
+			want:     []string{"go_gc_duration_seconds", "go_gc_duration_seconds_count", "go_gc_duration_seconds_sum"},
+		},
+		{
+			metadata: v1.MetricMetadata{Metric: "process_cpu_seconds", Type: v1.MetricTypeCounter},
+			want:     []string{"process_cpu_seconds", "process_cpu_seconds_total"},
+		},
+		{
+			metadata: v1.MetricMetadata{Metric: "process_cpu_seconds_total", Type: v1.MetricTypeCounter},
+			want:     []string{"process_cpu_seconds_total"},
+		},
+		{
+			metadata: v1.MetricMetadata{Metric: "up", Type: v1.MetricTypeGauge},
+			want:     []string{"up"},
+		},
+	} {
+		got := seriesNames(tc.metadata)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expected %v for %s, got %v", tc.want, tc.metadata.Metric, got)
+		}
+	}
+}
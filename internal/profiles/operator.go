@@ -0,0 +1,244 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// ValidationResult has the reports generated by validating a profile.
+type ValidationResult struct {
+
+	// Report has the discrepancies between the rules and the profile-specific monitors.
+	Report *report.Report
+
+	// Savings has the projected savings of the implemented profile-specific monitors, if requested.
+	Savings *report.Report
+}
+
+// errNoPrometheus is returned for operations that query the Prometheus instance, when run offline, for eg., projecting
+// the savings, as they are computed from the scraped series.
+var errNoPrometheus = errors.New("a Prometheus instance is required")
+
+// errNoRulesProvider is returned when validating a profile without any rules to validate it against.
+var errNoRulesProvider = errors.New("a rules provider is required")
+
+// generatedMetrics are the metrics that Prometheus generates on its own, either for every scrape, which are not subject
+// to the metric relabeling of the endpoint, or for every alert.
+var generatedMetrics = sets.New[string](
+	"up",
+	"scrape_duration_seconds",
+	"scrape_samples_scraped",
+	"scrape_samples_post_metric_relabeling",
+	"scrape_series_added",
+	"ALERTS",
+	"ALERTS_FOR_STATE",
+)
+
+// profileOperator validates a profile, by checking that the metrics the rules depend on are not dropped by the
+// profile-specific monitors.
+type profileOperator struct {
+	profile *Profile
+}
+
+// Operator validates the profile against the monitors listed by lister, and the rules provided by rulesProvider. The
+// client is optional, and only used to look up the loaded metrics and the targets, and to project the savings.
+func (o *profileOperator) Operator(ctx context.Context, lister MonitorLister, rulesProvider RulesProvider, c *client.Client, noisy, savings bool) (*ValidationResult, error) {
+	klog.V(1).Infof("validating profile %s: %s", o.profile.Name, o.profile.Description)
+	if rulesProvider == nil {
+		return nil, errNoRulesProvider
+	}
+
+	// Fetch all monitors for the profile.
+	podMonitors, serviceMonitors, err := FetchMonitorsForProfile(ctx, lister, o.profile.Name, noisy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitors for profile %s: %w", o.profile.Name, err)
+	}
+
+	// `metrics` has all the loaded metrics that are present in the Prometheus instance at `--address`, and
+	// `targetLabelSets` has the label sets of all targets discovered by it, keyed by their scrape pool. The latter are
+	// used as the candidate series that the relabeling chains are applied to. Both are left empty when validating the
+	// rendered manifests offline, in which case every scraped metric is considered loaded.
+	metrics := sets.Set[string]{}
+	targetLabelSets := map[string][]model.LabelSet{}
+	if c != nil {
+		targets, err := c.TargetsMetadata(ctx, "", "", "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch targets metadata: %w", err)
+		}
+		for _, data := range targets {
+			metrics.Insert(seriesNames(data)...)
+		}
+		targetsResult, err := c.Targets(ctx)
+		if err != nil {
+			klog.Warningf("failed to fetch targets, relabeling will be applied to metric names alone: %v", err)
+		}
+		for _, target := range targetsResult.Active {
+			targetLabelSets[target.ScrapePool] = append(targetLabelSets[target.ScrapePool], target.Labels)
+		}
+	}
+
+	// `rules` has all the rules discovered by the Prometheus instance at `--address`, or the ones present in the rendered
+	// manifests.
+	rules, err := rulesProvider.Rules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rules: %w", err)
+	}
+
+	// Check if the metrics in the rules are loaded. If not, check if they survive the metric relabeling chain of any of
+	// the monitor endpoints. If they do, then we have a direct correlation between a rule using a metric that is defined
+	// by a profile-specific monitor. This essentially means that the associated profile does not have all the required
+	// metrics available at this point of time. Conversely, loaded metrics that do not survive the relabeling chain of
+	// any of the monitor endpoints are dropped by the profile, while a rule depends on them.
+	r := report.New(report.KindValidation, string(o.profile.Name))
+
+	// recorded has the metrics recorded by the rules, which are never scraped, and thus never kept or dropped.
+	recorded := sets.Set[string]{}
+	for _, group := range rules.Groups {
+		for _, rule := range group.Rules {
+			if v, ok := rule.(v1.RecordingRule); ok {
+				recorded.Insert(v.Name)
+			}
+		}
+	}
+
+	// relabelings has the metric relabeling chains of all endpoints from all the monitors.
+	var relabelings []endpointRelabeling
+	for _, servicemonitor := range serviceMonitors.Items {
+		er, err := extractRelabelingsFromServiceMonitor(servicemonitor)
+		if err != nil {
+			r.Discrepancies = append(r.Discrepancies, report.Discrepancy{
+				Monitor: servicemonitor.Name,
+				Error:   fmt.Sprintf("failed to parse metric relabelings: %v", err),
+			})
+
+			continue
+		}
+		relabelings = append(relabelings, er...)
+	}
+	for _, podmonitor := range podMonitors.Items {
+		er, err := extractRelabelingsFromPodMonitor(podmonitor)
+		if err != nil {
+			r.Discrepancies = append(r.Discrepancies, report.Discrepancy{
+				Monitor: podmonitor.Name,
+				Error:   fmt.Sprintf("failed to parse metric relabelings: %v", err),
+			})
+
+			continue
+		}
+		relabelings = append(relabelings, er...)
+	}
+
+	for _, group := range rules.Groups {
+		for _, rule := range group.Rules {
+			var q string
+			var ruleName string
+			switch v := rule.(type) {
+			case v1.RecordingRule:
+				q = v.Query
+				ruleName = v.Name
+			case v1.AlertingRule:
+				q = v.Query
+				ruleName = v.Name
+			default:
+				r.Discrepancies = append(r.Discrepancies, report.Discrepancy{
+					Group: group.Name,
+					File:  group.File,
+					Error: fmt.Sprintf("unknown rule type %T", v),
+				})
+			}
+			if q == "" {
+				continue
+			}
+			expr, err := parser.ParseExpr(q)
+			if err != nil {
+				r.Discrepancies = append(r.Discrepancies, report.Discrepancy{
+					Group: group.Name,
+					File:  group.File,
+					Rule:  ruleName,
+					Query: q,
+					Error: fmt.Sprintf("failed to parse query: %v", err),
+				})
+
+				continue
+			}
+			u := sets.Set[string]{}
+			parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+				n, ok := node.(*parser.VectorSelector)
+
+				// Do not throw for metrics that occur more than once in the same query, this is verbose and provides no
+				// additional insight whatsoever.
+				if !ok || n.Name == "" || u.Has(n.Name) || recorded.Has(n.Name) || generatedMetrics.Has(n.Name) {
+					return nil
+				}
+				u.Insert(n.Name)
+				discrepancy := report.Discrepancy{
+					Group:  group.Name,
+					File:   group.File,
+					Rule:   ruleName,
+					Query:  q,
+					Metric: n.Name,
+				}
+
+				// Throw if:
+				//  * a metric is present one of the rule files, and,
+				//  * it is not loaded...
+				if c != nil && !metrics.Has(n.Name) {
+					for _, relabeling := range relabelings {
+						// * ...while a profile depends on it.
+						if relabeling.keeps(n.Name, targetLabelSets[relabeling.scrapePool]) {
+							endpoint := relabeling.endpoint
+							loaded := discrepancy
+							loaded.Monitor = relabeling.monitor
+							loaded.Endpoint = &endpoint
+							loaded.Error = ErrLoaded
+							r.Discrepancies = append(r.Discrepancies, loaded)
+						}
+					}
+
+					return nil
+				}
+
+				// Also throw if it is loaded, or may be, offline, while none of the monitor endpoints keep it.
+				for _, relabeling := range relabelings {
+					if relabeling.keeps(n.Name, targetLabelSets[relabeling.scrapePool]) {
+						return nil
+					}
+				}
+				discrepancy.Error = ErrDropped
+				r.Discrepancies = append(r.Discrepancies, discrepancy)
+
+				return nil
+			})
+		}
+	}
+
+	result := &ValidationResult{Report: r}
+
+	// Project the savings of the implemented profile-specific monitors over the full scrape, if requested.
+	if savings && o.profile.IsDefault() {
+		klog.Warningf("not projecting savings for profile %s: %v", o.profile.Name, errDefaultProfile)
+	} else if savings && c == nil {
+		return nil, fmt.Errorf("failed to project savings: %w", errNoPrometheus)
+	} else if savings {
+		endpoints, err := implementedSavingsEndpoints(ctx, lister, o.profile)
+		if err != nil {
+			return nil, err
+		}
+		result.Savings, err = savingsReport(ctx, c, o.profile.Name, endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to project savings: %w", err)
+		}
+	}
+
+	return result, nil
+}
@@ -5,45 +5,58 @@ import (
 	"context"
 
 	"github.com/rexagod/cpv/internal/client"
-	"k8s.io/client-go/dynamic"
+	"github.com/rexagod/cpv/internal/report"
 )
 
 // operator is an interface that defines the Operator method, which must be implemented by all profile operators.
 type operator interface {
 	Operator(
 		context.Context,
-		*dynamic.DynamicClient,
+		MonitorLister,
+		RulesProvider,
 		*client.Client,
 		bool,
-	) error
+		bool,
+	) (*ValidationResult, error)
 }
 
-// ProfileOperators is a map of all the profile operators.
-var ProfileOperators = map[CollectionProfile]operator{
-	FullCollectionProfile: nil,
+// ProfileOperator returns the operator of the registered profile, which validates it.
+//
+//nolint:ireturn
+func ProfileOperator(name CollectionProfile) (operator, error) {
+	p, err := LookupProfile(name)
+	if err != nil {
+		return nil, err
+	}
 
-	// A minimal collection profile is a collection profile that only collects metrics necessary for:
-	//  * alerts,
-	//  * dashboards,
-	//  * recording rules, and,
-	//  * telemetry.
-	MinimalCollectionProfile: &minimalProfileOperator{},
+	return &profileOperator{profile: p}, nil
 }
 
-// extractor is an interface that defines the Extract method, which must be implemented by all profile extractors.
+// extractor is an interface that defines the Extract and Explain methods, which must be implemented by all profile
+// extractors.
 type extractor interface {
 	Extract(
 		context.Context,
 		*client.Client,
-		...interface{},
-	) error
+		ExtractRequest,
+	) (*ExtractResult, error)
+	Explain(
+		context.Context,
+		*client.Client,
+		[]MetricSource,
+		string,
+	) (*report.Report, error)
 }
 
-// ProfileExtractors is a map of all the profile extractor.
-var ProfileExtractors = map[CollectionProfile]extractor{
-	FullCollectionProfile: nil,
-
-	// A minimal collection profile Extractor estimates the metrics needed to implement minimal collection profile from a
-	// given set of constraints (targets).
-	MinimalCollectionProfile: &minimalProfileExtractor{},
+// ProfileExtractor returns the extractor of the registered profile, which estimates the metrics needed to implement it
+// from its sources.
+//
+//nolint:ireturn
+func ProfileExtractor(name CollectionProfile) (extractor, error) {
+	p, err := LookupProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profileExtractor{profile: p}, nil
 }
@@ -0,0 +1,430 @@
+package profiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/fake"
+	"github.com/rexagod/cpv/internal/manifests"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// newFakes returns a client for the fake Prometheus instance, and a lister for the monitors within the fake cluster,
+// both populated from the fixtures within testdata.
+func newFakes(t *testing.T) (*client.Client, MonitorLister) {
+	t.Helper()
+
+	p := fake.NewPrometheus(t, filepath.Join("testdata", "prometheus.yaml"))
+	c := client.NewClient(context.Background(), p.URL, config.DefaultHTTPClientConfig, client.RequestOptions{})
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	dc := fake.NewDynamicClient(t, filepath.Join("testdata", "manifests", "monitors.yaml"))
+
+	return c, NewClusterMonitorLister(dc)
+}
+
+// assertGolden compares got with the golden file named name, or updates the golden file if -update is set. Absolute
+// paths to testdata are made relative, so that the golden files do not depend on where the repository is checked out.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = strings.ReplaceAll(got, testdata, "testdata")
+	golden := filepath.Join("testdata", "golden", name)
+	if *update {
+		err = os.WriteFile(golden, []byte(got), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -update to generate it: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match the golden file, run with -update to update it, got:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// renderReport renders the report as YAML.
+func renderReport(t *testing.T, r *report.Report) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := r.Write(&b, report.FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestOperator(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		profile CollectionProfile
+		savings bool
+	}{
+		{profile: FullCollectionProfile},
+		{profile: MinimalCollectionProfile, savings: true},
+	} {
+		tc := tc
+		t.Run(string(tc.profile), func(t *testing.T) {
+			t.Parallel()
+
+			c, lister := newFakes(t)
+			op, err := ProfileOperator(tc.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := op.Operator(context.Background(), lister, c, c, false, tc.savings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, string(tc.profile)+"-validation-report.yaml", renderReport(t, result.Report))
+			if tc.savings {
+				assertGolden(t, string(tc.profile)+"-validation-savings-report.yaml", renderReport(t, result.Savings))
+			}
+		})
+	}
+}
+
+func TestOperatorOffline(t *testing.T) {
+	t.Parallel()
+
+	m, err := manifests.Load(filepath.Join("testdata", "manifests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, err := ProfileOperator(MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lister := NewManifestsMonitorLister(m)
+	rulesProvider := NewManifestsRulesProvider(m, "", "")
+	result, err := op.Operator(context.Background(), lister, rulesProvider, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offline, the metrics that the profile keeps are not reported, while the ones it drops are.
+	var got []string
+	for _, discrepancy := range result.Report.Discrepancies {
+		if discrepancy.Error != ErrDropped {
+			t.Errorf("expected only dropped metrics to be reported, got: %+v", discrepancy)
+		}
+		got = append(got, discrepancy.Metric)
+	}
+	if want := []string{"kube_deployment_spec_replicas", "kube_deployment_status_replicas_available"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the dropped metrics %v to be reported, got %v", want, got)
+	}
+
+	// The savings are computed from the scraped series, so they cannot be projected offline.
+	if _, err = op.Operator(context.Background(), lister, rulesProvider, nil, false, true); err == nil {
+		t.Error("expected an error projecting the savings offline")
+	}
+}
+
+// failingLister fails to list any monitors.
+type failingLister struct{}
+
+func (failingLister) ListServiceMonitors(context.Context, string) (*monitoringv1.ServiceMonitorList, error) {
+	return nil, errors.New("forbidden")
+}
+
+func (failingLister) ListPodMonitors(context.Context, string) (*monitoringv1.PodMonitorList, error) {
+	return nil, errors.New("forbidden")
+}
+
+func TestOperatorListerError(t *testing.T) {
+	t.Parallel()
+
+	op, err := ProfileOperator(MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifests.Load(filepath.Join("testdata", "manifests"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = op.Operator(context.Background(), failingLister{}, NewManifestsRulesProvider(m, "", ""), nil, false, false)
+	if err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("expected the lister error to be returned, got %v", err)
+	}
+	_, err = op.Operator(context.Background(), NewManifestsMonitorLister(m), nil, nil, false, false)
+	if !errors.Is(err, errNoRulesProvider) {
+		t.Errorf("expected %v, got %v", errNoRulesProvider, err)
+	}
+}
+
+func TestReportImplementationStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, profile := range []CollectionProfile{"", FullCollectionProfile, MinimalCollectionProfile} {
+		profile := profile
+		name := string(profile)
+		if name == "" {
+			name = "all"
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, lister := newFakes(t)
+			r, err := ReportImplementationStatus(context.Background(), lister, profile, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, name+"-implementation-status.yaml", renderReport(t, r))
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	c, lister := newFakes(t)
+	e, err := ProfileExtractor(MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.Extract(context.Background(), c, ExtractRequest{
+		Sources: []MetricSource{
+			NewAllowListSource(filepath.Join("testdata", "allow-list.yaml")),
+			NewRuleFilesSource([]string{filepath.Join("testdata", "rules.yaml")}),
+		},
+		Lister:            lister,
+		OutputCardinality: true,
+		LabelCardinality:  true,
+		Savings:           true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "minimal-extraction-report.yaml", renderReport(t, result.Report))
+	assertGolden(t, "minimal-relabel-config.yaml", result.RelabelConfig)
+	assertGolden(t, "minimal-labeldrop-config.yaml", result.LabelDropConfig)
+	assertGolden(t, "minimal-monitors.yaml", strings.Join(result.Monitors, "---\n"))
+	assertGolden(t, "minimal-extraction-savings-report.yaml", renderReport(t, result.Savings))
+}
+
+func TestExtractOffline(t *testing.T) {
+	t.Parallel()
+
+	e, err := ProfileExtractor(MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []MetricSource{
+		NewAllowListSource(filepath.Join("testdata", "allow-list.yaml")),
+		NewRuleFilesSource([]string{filepath.Join("testdata", "rules.yaml")}),
+		NewDashboardsSource([]string{filepath.Join("testdata", "dashboards", "nodes.json")}),
+		NewTelemetrySource(nil, filepath.Join("testdata", "telemetry", "metrics.yaml"), ""),
+	}
+
+	// Local sources need no Prometheus instance, unless the cardinalities are evaluated. The monitors are not generated
+	// though, since the metrics exposed by their targets are unknown.
+	_, lister := newFakes(t)
+	result, err := e.Extract(context.Background(), nil, ExtractRequest{Sources: sources, Lister: lister})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Report.Metrics) == 0 || result.RelabelConfig == "" {
+		t.Errorf("expected the metrics to be extracted offline, got %+v", result.Report)
+	}
+	if len(result.Monitors) != 0 {
+		t.Errorf("expected no monitors to be generated offline, got %v", result.Monitors)
+	}
+	if _, err = e.Explain(context.Background(), nil, sources, "up"); err != nil {
+		t.Errorf("expected the metric to be explained offline, got %v", err)
+	}
+	_, err = e.Extract(context.Background(), nil, ExtractRequest{Sources: sources, OutputCardinality: true})
+	if !errors.Is(err, errNoPrometheus) {
+		t.Errorf("expected %v evaluating cardinalities offline, got %v", errNoPrometheus, err)
+	}
+	_, err = e.Extract(context.Background(), nil, ExtractRequest{Sources: []MetricSource{NewTargetsSource(`{job="etcd"}`)}})
+	if !errors.Is(err, errNoPrometheus) {
+		t.Errorf("expected %v sourcing targets offline, got %v", errNoPrometheus, err)
+	}
+}
+
+func TestGenerateProfileMonitors(t *testing.T) {
+	t.Parallel()
+
+	c, lister := newFakes(t)
+	p, err := LookupProfile(MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := sets.New[string]("etcd_disk_wal_fsync_duration_seconds_bucket", "etcd_server_has_leader")
+	documents, err := generateProfileMonitors(context.Background(), c, lister, p, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The targets metadata only has the histogram's family, while the rules use its series.
+	var podMonitor *monitoringv1.PodMonitor
+	for _, document := range documents {
+		if strings.Contains(document, "kind: PodMonitor") {
+			err = yaml.UnmarshalStrict([]byte(document), &podMonitor)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if podMonitor == nil || podMonitor.Name != "etcd-minimal" {
+		t.Fatalf("expected the etcd-minimal pod monitor to be generated, got: %v", documents)
+	}
+	if len(documents) != 1 {
+		t.Errorf("expected the monitors that keep none of the metrics to be left out, got: %v", documents)
+	}
+	if _, err := toRelabelConfig(sets.Set[string]{}); !errors.Is(err, errNoMetricsToKeep) {
+		t.Errorf("expected %v, got %v", errNoMetricsToKeep, err)
+	}
+	relabelings, err := extractRelabelingsFromPodMonitor(podMonitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for metric, want := range map[string]bool{
+		"etcd_disk_wal_fsync_duration_seconds_bucket": true,
+		"etcd_server_has_leader":                      true,
+		"etcd_disk_wal_fsync_duration_seconds_sum":    false,
+	} {
+		if got := relabelings[0].keeps(metric, nil); got != want {
+			t.Errorf("expected %s to be kept: %t, got %t", metric, want, got)
+		}
+	}
+}
+
+// metadataProvider serves the targets, and the metadata of the metrics they expose, from memory.
+type metadataProvider struct {
+	targets  v1.TargetsResult
+	metadata []v1.MetricMetadata
+}
+
+func (p *metadataProvider) Targets(context.Context) (v1.TargetsResult, error) {
+	return p.targets, nil
+}
+
+func (p *metadataProvider) TargetsMetadata(context.Context, string, string, string) ([]v1.MetricMetadata, error) {
+	return p.metadata, nil
+}
+
+func TestExtractTargets(t *testing.T) {
+	t.Parallel()
+
+	newThanosClient := func(t *testing.T) *client.Client {
+		t.Helper()
+
+		p := fake.NewPrometheus(t, filepath.Join("testdata", "prometheus.yaml"), fake.WithoutTargetsMetadata())
+		c := client.NewClient(context.Background(), p.URL, config.DefaultHTTPClientConfig, client.RequestOptions{})
+		if err := c.Init(); err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+	newProviderClient := func(t *testing.T) *client.Client {
+		t.Helper()
+
+		c, _ := newFakes(t)
+
+		return client.NewClientForAPI(c.API, &metadataProvider{
+			targets: v1.TargetsResult{Active: []v1.ActiveTarget{{
+				ScrapePool: "serviceMonitor/openshift-monitoring/node-exporter/0",
+				Labels:     model.LabelSet{model.JobLabel: "node-exporter", model.InstanceLabel: "node-b:9100"},
+			}}},
+			metadata: []v1.MetricMetadata{{
+				Target: map[string]string{"job": "node-exporter", "instance": "node-b:9100"},
+				Metric: "node_load1",
+				Type:   v1.MetricTypeGauge,
+			}},
+		})
+	}
+	for _, tc := range []struct {
+		name      string
+		newClient func(t *testing.T) *client.Client
+		want      []string
+	}{
+		{
+			name: "targets metadata",
+			newClient: func(t *testing.T) *client.Client {
+				t.Helper()
+
+				c, _ := newFakes(t)
+
+				return c
+			},
+			want: []string{"etcd_disk_wal_fsync_duration_seconds", "etcd_server_has_leader", "node_cpu_seconds_total", "node_memory_MemAvailable_bytes"},
+		},
+		{
+			name:      "series fallback",
+			newClient: newThanosClient,
+			want:      []string{"etcd_disk_wal_fsync_duration_seconds", "etcd_server_has_leader", "node_cpu_seconds_total", "node_memory_MemAvailable_bytes"},
+		},
+		{
+			name:      "metadata provider",
+			newClient: newProviderClient,
+			want:      []string{"node_load1"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := ProfileExtractor(MinimalCollectionProfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := e.Extract(context.Background(), tc.newClient(t), ExtractRequest{
+				Sources: []MetricSource{NewTargetsSource(`{job=~"node-exporter|etcd", __name__!~"node_network_.+"}`)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, metric := range result.Report.Metrics {
+				got = append(got, metric.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExtractDefaultProfile(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newFakes(t)
+	e, err := ProfileExtractor(FullCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.Extract(context.Background(), c, ExtractRequest{})
+	if err == nil {
+		t.Fatal("expected an error when extracting the default profile")
+	}
+}
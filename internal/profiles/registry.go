@@ -0,0 +1,153 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Source is a source that defines the metrics a profile requires, when extracting them.
+type Source string
+
+const (
+	SourceAllowList  Source = "allowList"
+	SourceRules      Source = "rules"
+	SourceDashboards Source = "dashboards"
+	SourceTelemetry  Source = "telemetry"
+	SourceTargets    Source = "targets"
+)
+
+// Sources are all the sources that may define the metrics a profile requires.
+var Sources = []Source{SourceAllowList, SourceRules, SourceDashboards, SourceTelemetry, SourceTargets}
+
+// profileNameRegex matches the names that may be used as the value of the CollectionProfileOptInLabel.
+var profileNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Profile is the declarative definition of a collection profile.
+type Profile struct {
+	Name        CollectionProfile `json:"name"`
+	Description string            `json:"description"`
+
+	// Sources are the sources that define the metrics the profile requires, when extracting them. Leave empty to use
+	// all of them.
+	Sources []Source `json:"sources"`
+
+	// Suffix is appended to the names of the monitors that have opted-in to the default profile, to name their
+	// profile-specific counterparts. Defaults to "-<name>".
+	Suffix string `json:"suffix"`
+}
+
+// registryMu guards the registry, and the registration order, since profiles may be registered by programs that embed
+// cpv while others are being looked up.
+var registryMu sync.RWMutex
+
+// registry has all registered profiles, keyed by their names.
+var registry = map[CollectionProfile]*Profile{
+	FullCollectionProfile: {
+		Name:        FullCollectionProfile,
+		Description: "The default profile, that collects all metrics.",
+	},
+
+	// A minimal collection profile is a collection profile that only collects metrics necessary for:
+	//  * alerts,
+	//  * dashboards,
+	//  * recording rules, and,
+	//  * telemetry.
+	MinimalCollectionProfile: {
+		Name:        MinimalCollectionProfile,
+		Description: "Collects only the metrics needed by alerts, dashboards, recording rules and telemetry.",
+		Sources:     Sources,
+		Suffix:      "-" + string(MinimalCollectionProfile),
+	},
+}
+
+// registrationOrder has the names of all registered profiles, in the order they were registered.
+var registrationOrder = CollectionProfiles{FullCollectionProfile, MinimalCollectionProfile}
+
+// RegisterProfile validates the profile, and registers it alongside the built-in ones, so that it may be extracted,
+// validated, and reported the status of.
+func RegisterProfile(p Profile) error {
+	if !profileNameRegex.MatchString(string(p.Name)) {
+		return fmt.Errorf("invalid profile name %q, expected lowercase alphanumerics and dashes", p.Name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[p.Name]; ok {
+		return fmt.Errorf("profile %s is already registered", p.Name)
+	}
+	if len(p.Sources) == 0 {
+		p.Sources = Sources
+	}
+	for _, source := range p.Sources {
+		if !isSupportedSource(source) {
+			return fmt.Errorf("profile %s: unsupported source %q", p.Name, source)
+		}
+	}
+	if p.Suffix == "" {
+		p.Suffix = "-" + string(p.Name)
+	}
+	for _, registered := range registry {
+		if registered.Suffix == p.Suffix {
+			return fmt.Errorf("profile %s: suffix %q is already used by profile %s", p.Name, p.Suffix, registered.Name)
+		}
+	}
+	registry[p.Name] = &p
+	registrationOrder = append(registrationOrder, p.Name)
+
+	return nil
+}
+
+// LookupProfile returns the registered profile with the given name.
+func LookupProfile(name CollectionProfile) (*Profile, error) {
+	registryMu.RLock()
+	p, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, expected one of: %s", name, SupportedCollectionProfiles())
+	}
+
+	return p, nil
+}
+
+// IsDefault returns true for the default profile, which every other profile is a subset of.
+func (p *Profile) IsDefault() bool {
+	return p.Name == FullCollectionProfile
+}
+
+// CounterpartName returns the name of the profile-specific counterpart of a monitor that has opted-in to the default
+// profile.
+func (p *Profile) CounterpartName(name string) string {
+	return name + p.Suffix
+}
+
+// IsCounterpartName returns true if the monitor is named after the profile-specific counterpart of another one.
+func (p *Profile) IsCounterpartName(name string) bool {
+	return p.Suffix != "" && strings.HasSuffix(name, p.Suffix)
+}
+
+// uses returns true if the profile sources its required metrics from the source.
+func (p *Profile) uses(source Source) bool {
+	for _, s := range p.Sources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSupportedSource returns true if the source may define the metrics a profile requires.
+func isSupportedSource(source Source) bool {
+	for _, s := range Sources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errDefaultProfile is returned for operations that do not apply to the default profile, since it keeps all metrics.
+var errDefaultProfile = errors.New("the default profile keeps all metrics")
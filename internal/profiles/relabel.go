@@ -0,0 +1,159 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// endpointRelabeling is the metric relabeling chain of a single monitor endpoint.
+type endpointRelabeling struct {
+	monitor  string
+	endpoint int
+
+	// scrapePool is the scrape pool that the Prometheus Operator generates for the endpoint, used to correlate it with
+	// the targets discovered by Prometheus.
+	scrapePool string
+	configs    []*relabel.Config
+}
+
+// keeps returns true if the metric survives the relabeling chain for at least one of the given target label sets. A
+// metric that is renamed by the chain is not considered to be kept. If no target label sets are given, the chain is
+// applied to the metric name alone.
+func (e *endpointRelabeling) keeps(metric string, targetLabelSets []model.LabelSet) bool {
+	if len(targetLabelSets) == 0 {
+		targetLabelSets = []model.LabelSet{{}}
+	}
+	for _, targetLabelSet := range targetLabelSets {
+		m := make(map[string]string, len(targetLabelSet)+1)
+		for name, value := range targetLabelSet {
+			m[string(name)] = string(value)
+		}
+		m[model.MetricNameLabel] = metric
+		ls, keep := relabel.Process(labels.FromMap(m), e.configs...)
+		if keep && ls.Get(model.MetricNameLabel) == metric {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toRelabelConfigs converts the relabel configs of a monitor endpoint into the ones used by Prometheus, defaulting the
+// fields left out in the same way the Prometheus Operator does.
+func toRelabelConfigs(relabelConfigs []*monitoringv1.RelabelConfig) ([]*relabel.Config, error) {
+	var configs []*relabel.Config
+	for _, relabelConfig := range relabelConfigs {
+		config := relabel.DefaultRelabelConfig
+		for _, sourceLabel := range relabelConfig.SourceLabels {
+			config.SourceLabels = append(config.SourceLabels, model.LabelName(sourceLabel))
+		}
+		if relabelConfig.Separator != "" {
+			config.Separator = relabelConfig.Separator
+		}
+		if relabelConfig.Regex != "" {
+			regex, err := relabel.NewRegexp(relabelConfig.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile regex %q: %w", relabelConfig.Regex, err)
+			}
+			config.Regex = regex
+		}
+		config.Modulus = relabelConfig.Modulus
+		config.TargetLabel = relabelConfig.TargetLabel
+		if relabelConfig.Replacement != "" {
+			config.Replacement = relabelConfig.Replacement
+		}
+		if relabelConfig.Action != "" {
+			config.Action = relabel.Action(strings.ToLower(relabelConfig.Action))
+		}
+		err := validateRelabelConfig(&config)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, &config)
+	}
+
+	return configs, nil
+}
+
+// validateRelabelConfig applies the checks that Prometheus applies when loading a relabel config, since the ones of the
+// monitors are converted as-is, and relabel.Process panics on an unknown action, or a hashmod without a modulus. The
+// actions that only act on the value of the source labels also require them to be set.
+func validateRelabelConfig(config *relabel.Config) error {
+	switch config.Action {
+	case relabel.Replace, relabel.Keep, relabel.Drop, relabel.LabelMap, relabel.LabelDrop, relabel.LabelKeep:
+	case relabel.HashMod, relabel.Lowercase, relabel.Uppercase, relabel.KeepEqual, relabel.DropEqual:
+		if len(config.SourceLabels) == 0 {
+			return fmt.Errorf("relabel configuration for %s action requires 'sourceLabels' value", config.Action)
+		}
+	default:
+		return fmt.Errorf("unknown relabel action %q", config.Action)
+	}
+	if config.Action == relabel.HashMod && config.Modulus == 0 {
+		return errors.New("relabel configuration for hashmod requires non-zero modulus")
+	}
+	switch config.Action {
+	case relabel.Replace, relabel.HashMod, relabel.Lowercase, relabel.Uppercase, relabel.KeepEqual, relabel.DropEqual:
+		if config.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires 'targetLabel' value", config.Action)
+		}
+	case relabel.Keep, relabel.Drop, relabel.LabelMap, relabel.LabelDrop, relabel.LabelKeep:
+	}
+
+	return nil
+}
+
+// extractRelabelingsFromServiceMonitor returns the metric relabeling chain of every endpoint of the service monitor.
+func extractRelabelingsFromServiceMonitor(serviceMonitor *monitoringv1.ServiceMonitor) ([]endpointRelabeling, error) {
+	var relabelings []endpointRelabeling
+	for i, endpoint := range serviceMonitor.Spec.Endpoints {
+		configs, err := toRelabelConfigs(endpoint.MetricRelabelConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %d: %w", i, err)
+		}
+		relabelings = append(relabelings, endpointRelabeling{
+			monitor:    serviceMonitor.GetName(),
+			endpoint:   i,
+			scrapePool: serviceMonitorScrapePool(serviceMonitor, i),
+			configs:    configs,
+		})
+	}
+
+	return relabelings, nil
+}
+
+// extractRelabelingsFromPodMonitor returns the metric relabeling chain of every endpoint of the pod monitor.
+func extractRelabelingsFromPodMonitor(podMonitor *monitoringv1.PodMonitor) ([]endpointRelabeling, error) {
+	var relabelings []endpointRelabeling
+	for i, endpoint := range podMonitor.Spec.PodMetricsEndpoints {
+		configs, err := toRelabelConfigs(endpoint.MetricRelabelConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %d: %w", i, err)
+		}
+		relabelings = append(relabelings, endpointRelabeling{
+			monitor:    podMonitor.GetName(),
+			endpoint:   i,
+			scrapePool: podMonitorScrapePool(podMonitor, i),
+			configs:    configs,
+		})
+	}
+
+	return relabelings, nil
+}
+
+// serviceMonitorScrapePool returns the scrape pool that the Prometheus Operator generates for the i-th endpoint of the
+// service monitor.
+func serviceMonitorScrapePool(serviceMonitor *monitoringv1.ServiceMonitor, i int) string {
+	return fmt.Sprintf("serviceMonitor/%s/%s/%d", serviceMonitor.GetNamespace(), serviceMonitor.GetName(), i)
+}
+
+// podMonitorScrapePool returns the scrape pool that the Prometheus Operator generates for the i-th endpoint of the pod
+// monitor.
+func podMonitorScrapePool(podMonitor *monitoringv1.PodMonitor, i int) string {
+	return fmt.Sprintf("podMonitor/%s/%s/%d", podMonitor.GetNamespace(), podMonitor.GetName(), i)
+}
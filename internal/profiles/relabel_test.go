@@ -0,0 +1,178 @@
+package profiles
+
+import (
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+)
+
+func TestToRelabelConfigs(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		config  monitoringv1.RelabelConfig
+		wantErr bool
+	}{
+		{
+			name:   "default action",
+			config: monitoringv1.RelabelConfig{SourceLabels: []monitoringv1.LabelName{"pod"}, TargetLabel: "instance"},
+		},
+		{
+			name:   "keep",
+			config: monitoringv1.RelabelConfig{Action: "keep", SourceLabels: []monitoringv1.LabelName{"__name__"}, Regex: "up"},
+		},
+		{
+			name:   "hashmod",
+			config: monitoringv1.RelabelConfig{Action: "hashmod", SourceLabels: []monitoringv1.LabelName{"instance"}, TargetLabel: "shard", Modulus: 2},
+		},
+		{
+			name:   "labeldrop",
+			config: monitoringv1.RelabelConfig{Action: "labeldrop", Regex: "container"},
+		},
+		{
+			name:    "unknown action",
+			config:  monitoringv1.RelabelConfig{Action: "keepall", SourceLabels: []monitoringv1.LabelName{"__name__"}},
+			wantErr: true,
+		},
+		{
+			name:    "hashmod without modulus",
+			config:  monitoringv1.RelabelConfig{Action: "hashmod", SourceLabels: []monitoringv1.LabelName{"instance"}, TargetLabel: "shard"},
+			wantErr: true,
+		},
+		{
+			name:    "hashmod without source labels",
+			config:  monitoringv1.RelabelConfig{Action: "hashmod", TargetLabel: "shard", Modulus: 2},
+			wantErr: true,
+		},
+		{
+			name:    "replace without target label",
+			config:  monitoringv1.RelabelConfig{Action: "replace", SourceLabels: []monitoringv1.LabelName{"pod"}},
+			wantErr: true,
+		},
+		{
+			name:    "hashmod without target label",
+			config:  monitoringv1.RelabelConfig{Action: "hashmod", SourceLabels: []monitoringv1.LabelName{"instance"}, Modulus: 2},
+			wantErr: true,
+		},
+		{
+			name:    "lowercase without target label",
+			config:  monitoringv1.RelabelConfig{Action: "lowercase", SourceLabels: []monitoringv1.LabelName{"pod"}},
+			wantErr: true,
+		},
+		{
+			name:    "uppercase without source labels",
+			config:  monitoringv1.RelabelConfig{Action: "uppercase", TargetLabel: "pod"},
+			wantErr: true,
+		},
+		{
+			name:    "keepequal without target label",
+			config:  monitoringv1.RelabelConfig{Action: "keepequal", SourceLabels: []monitoringv1.LabelName{"pod"}},
+			wantErr: true,
+		},
+		{
+			name:    "dropequal without source labels",
+			config:  monitoringv1.RelabelConfig{Action: "dropequal", TargetLabel: "pod"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			config:  monitoringv1.RelabelConfig{Action: "keep", SourceLabels: []monitoringv1.LabelName{"__name__"}, Regex: "("},
+			wantErr: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := tc.config
+			_, err := toRelabelConfigs([]*monitoringv1.RelabelConfig{&config})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEndpointRelabelingKeeps(t *testing.T) {
+	t.Parallel()
+
+	targetLabelSets := []model.LabelSet{
+		{"job": "node-exporter", "instance": "node-a"},
+		{"job": "node-exporter", "instance": "node-b"},
+	}
+	for _, tc := range []struct {
+		name    string
+		configs []*monitoringv1.RelabelConfig
+		metric  string
+		want    bool
+	}{
+		{
+			name:   "no relabelings",
+			metric: "node_cpu_seconds_total",
+			want:   true,
+		},
+		{
+			name: "kept",
+			configs: []*monitoringv1.RelabelConfig{
+				{Action: "keep", SourceLabels: []monitoringv1.LabelName{"__name__"}, Regex: "node_cpu_seconds_total|up"},
+			},
+			metric: "node_cpu_seconds_total",
+			want:   true,
+		},
+		{
+			name: "dropped",
+			configs: []*monitoringv1.RelabelConfig{
+				{Action: "drop", SourceLabels: []monitoringv1.LabelName{"__name__"}, Regex: "node_cpu_.+"},
+			},
+			metric: "node_cpu_seconds_total",
+		},
+		{
+			name: "renamed",
+			configs: []*monitoringv1.RelabelConfig{
+				{SourceLabels: []monitoringv1.LabelName{"__name__"}, Regex: "node_(.+)", TargetLabel: "__name__", Replacement: "host_$1"},
+			},
+			metric: "node_cpu_seconds_total",
+		},
+		{
+			name: "kept for a target through a separator",
+			configs: []*monitoringv1.RelabelConfig{
+				{Action: "keep", SourceLabels: []monitoringv1.LabelName{"__name__", "instance"}, Separator: "@", Regex: "node_cpu_seconds_total@node-b"},
+			},
+			metric: "node_cpu_seconds_total",
+			want:   true,
+		},
+		{
+			name: "chained",
+			configs: []*monitoringv1.RelabelConfig{
+				{Action: "replace", SourceLabels: []monitoringv1.LabelName{"instance"}, Regex: "node-(.+)", TargetLabel: "node", Replacement: "$1"},
+				{Action: "drop", SourceLabels: []monitoringv1.LabelName{"node"}, Regex: "a|b"},
+			},
+			metric: "node_cpu_seconds_total",
+		},
+		{
+			name: "sharded",
+			configs: []*monitoringv1.RelabelConfig{
+				{Action: "hashmod", SourceLabels: []monitoringv1.LabelName{"instance"}, TargetLabel: "__tmp_shard", Modulus: 1},
+				{Action: "keep", SourceLabels: []monitoringv1.LabelName{"__tmp_shard"}, Regex: "0"},
+			},
+			metric: "node_cpu_seconds_total",
+			want:   true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			configs, err := toRelabelConfigs(tc.configs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &endpointRelabeling{configs: configs}
+			if got := e.keeps(tc.metric, targetLabelSets); got != tc.want {
+				t.Errorf("expected keeps to be %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
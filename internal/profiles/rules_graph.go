@@ -0,0 +1,249 @@
+package profiles
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// ruleNode is a rule, recording or alerting, along with the metrics it directly depends on.
+type ruleNode struct {
+	name   string
+	group  string
+	file   string
+	inputs sets.Set[string]
+}
+
+// ruleGraph maps the names recorded by recording rules to the rules that define them, so that metrics used within rule
+// expressions can be followed back to the metrics that are actually scraped.
+type ruleGraph struct {
+	// recordingRules has all rules that record a particular name, since the same name may be recorded more than once.
+	recordingRules map[string][]ruleNode
+
+	// rules has all rules, recording or alerting, in the order they are defined.
+	rules []ruleNode
+
+	// leaves memoizes the scraped metrics that a recorded name transitively depends on.
+	leaves map[string]sets.Set[string]
+}
+
+// buildRuleGraph parses all rule files and builds the dependency graph of the rules within them, marking the labels
+// that the rules reference within usage, if set.
+func buildRuleGraph(ruleFiles []string, usage *labelUsage) (*ruleGraph, error) {
+	g := &ruleGraph{
+		recordingRules: map[string][]ruleNode{},
+		leaves:         map[string]sets.Set[string]{},
+	}
+	for _, ruleFile := range ruleFiles {
+		ruleGroups, parseErr := rulefmt.ParseFile(ruleFile)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to parse rule file %s: %v", ruleFile, parseErr)
+		}
+		for _, group := range ruleGroups.Groups {
+			for _, rule := range group.Rules {
+				expr, err := parser.ParseExpr(rule.Expr.Value)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse expression in %s: %w", ruleFile, err)
+				}
+				usage.addExpr(expr)
+				inputs := extractMetricsFromExpr(expr)
+				r := ruleNode{
+					name:   rule.Record.Value,
+					group:  group.Name,
+					file:   ruleFile,
+					inputs: inputs,
+				}
+				if rule.Record.Value != "" {
+					g.recordingRules[rule.Record.Value] = append(g.recordingRules[rule.Record.Value], r)
+				} else {
+					r.name = rule.Alert.Value
+				}
+				g.rules = append(g.rules, r)
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// resolve expands every recorded name transitively, memoizing the scraped metrics it depends on, and returns the
+// dependency cycles encountered between recording rules. It must be called before missingInputs.
+func (g *ruleGraph) resolve() [][]string {
+	e := &expansion{
+		index:   map[string]int{},
+		low:     map[string]int{},
+		onStack: sets.Set[string]{},
+		leaves:  map[string]sets.Set[string]{},
+	}
+	for _, name := range sets.List(sets.KeySet(g.recordingRules)) {
+		if _, visited := e.index[name]; !visited {
+			g.expand(name, e)
+		}
+	}
+
+	return e.cycles
+}
+
+// provenance returns the rules that depend on every scraped metric, along with the shortest chain of recorded names
+// that leads from each rule to the metric.
+func (g *ruleGraph) provenance() map[string][]report.Provenance {
+	provenance := map[string][]report.Provenance{}
+	for _, rule := range g.rules {
+		chains := g.chains(rule.inputs)
+		for _, metric := range sets.List(sets.KeySet(chains)) {
+			provenance[metric] = append(provenance[metric], report.Provenance{
+				Source:   string(SourceRules),
+				Location: rule.file,
+				Group:    rule.group,
+				Rule:     rule.name,
+				Chain:    chains[metric],
+			})
+		}
+	}
+
+	return provenance
+}
+
+// chains returns the shortest chain of recorded names that leads from the inputs to every scraped metric they
+// transitively depend on, found by a breadth-first search through the recording rules.
+func (g *ruleGraph) chains(inputs sets.Set[string]) map[string][]string {
+	type step struct {
+		metric string
+		chain  []string
+	}
+	var queue []step
+	for _, input := range sets.List(inputs) {
+		queue = append(queue, step{metric: input})
+	}
+	chains := map[string][]string{}
+	visited := sets.Set[string]{}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if visited.Has(s.metric) {
+			continue
+		}
+		visited.Insert(s.metric)
+		rules, isRecorded := g.recordingRules[s.metric]
+		if !isRecorded {
+			chains[s.metric] = s.chain
+
+			continue
+		}
+		chain := append(append([]string{}, s.chain...), s.metric)
+		for _, rule := range rules {
+			for _, input := range sets.List(rule.inputs) {
+				queue = append(queue, step{metric: input, chain: chain})
+			}
+		}
+	}
+
+	return chains
+}
+
+// expansion is the state of expanding the rule graph, as a depth-first search that finds its strongly connected
+// components, i.e., the recorded names that depend on each other, and thus on the same scraped metrics.
+type expansion struct {
+	index   map[string]int
+	low     map[string]int
+	stack   []string
+	onStack sets.Set[string]
+
+	// leaves has the scraped metrics that a name on the stack depends on, either directly, or through the names outside
+	// of its component.
+	leaves map[string]sets.Set[string]
+
+	cycles [][]string
+}
+
+// expand memoizes the scraped metrics that the recorded name transitively depends on. The leaves are only memoized once
+// the whole component of the name is expanded, so that every name within a cycle ends up with the same, complete set,
+// and the cycle is recorded, starting from the first name of the component that was expanded.
+func (g *ruleGraph) expand(name string, e *expansion) {
+	e.index[name] = len(e.index)
+	e.low[name] = e.index[name]
+	e.stack = append(e.stack, name)
+	e.onStack.Insert(name)
+	leaves := sets.Set[string]{}
+	dependsOnItself := false
+	for _, rule := range g.recordingRules[name] {
+		for _, input := range sets.List(rule.inputs) {
+			if _, isRecorded := g.recordingRules[input]; !isRecorded {
+				leaves.Insert(input)
+
+				continue
+			}
+			dependsOnItself = dependsOnItself || input == name
+			if _, visited := e.index[input]; !visited {
+				g.expand(input, e)
+				if e.low[input] < e.low[name] {
+					e.low[name] = e.low[input]
+				}
+			} else if e.onStack.Has(input) && e.index[input] < e.low[name] {
+				e.low[name] = e.index[input]
+			}
+
+			// Inputs still on the stack are within the same component, and are accounted for once it is expanded.
+			if !e.onStack.Has(input) {
+				leaves = leaves.Union(g.leaves[input])
+			}
+		}
+	}
+	e.leaves[name] = leaves
+	if e.low[name] != e.index[name] {
+		return
+	}
+
+	// name is the first of its component to have been expanded, so the component is the rest of the stack.
+	i := len(e.stack) - 1
+	for e.stack[i] != name {
+		i--
+	}
+	component := e.stack[i:]
+	e.stack = e.stack[:i]
+	componentLeaves := sets.Set[string]{}
+	for _, member := range component {
+		componentLeaves = componentLeaves.Union(e.leaves[member])
+	}
+	for _, member := range component {
+		e.onStack.Delete(member)
+		delete(e.leaves, member)
+		g.leaves[member] = componentLeaves
+	}
+	if len(component) > 1 || dependsOnItself {
+		e.cycles = append(e.cycles, append(append([]string{}, component...), name))
+	}
+}
+
+// missingInput is a recording rule along with the scraped metrics it transitively depends on that are absent.
+type missingInput struct {
+	rule    ruleNode
+	metrics []string
+}
+
+// missingInputs returns the recording rules that transitively depend on scraped metrics absent from known, sorted by
+// the recorded name. It must be called after resolve.
+func (g *ruleGraph) missingInputs(known sets.Set[string]) []missingInput {
+	var missing []missingInput
+	for _, name := range sets.List(sets.KeySet(g.recordingRules)) {
+		for _, rule := range g.recordingRules[name] {
+			leaves := sets.Set[string]{}
+			for input := range rule.inputs {
+				if _, isRecorded := g.recordingRules[input]; isRecorded {
+					leaves = leaves.Union(g.leaves[input])
+				} else {
+					leaves.Insert(input)
+				}
+			}
+			if absent := sets.List(leaves.Difference(known)); len(absent) > 0 {
+				missing = append(missing, missingInput{rule: rule, metrics: absent})
+			}
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,44 @@
+package profiles
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestRuleGraphResolve(t *testing.T) {
+	t.Parallel()
+
+	g, err := buildRuleGraph([]string{filepath.Join("testdata", "rules-graph.yaml")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycles := g.resolve()
+	want := [][]string{
+		{"job:a:sum", "job:b:sum", "job:a:sum"},
+		{"ring:a", "ring:b", "ring:c", "ring:a"},
+	}
+	if !reflect.DeepEqual(cycles, want) {
+		t.Errorf("expected the cycles %v, got %v", want, cycles)
+	}
+
+	// Every name within a cycle depends on the scraped metrics of the whole cycle, regardless of where it was entered.
+	missing := map[string][]string{}
+	for _, m := range g.missingInputs(sets.New("node_cpu_seconds_total", "node_uname_info", "up")) {
+		missing[m.rule.name] = m.metrics
+	}
+	ring := []string{"node_load1", "node_load15", "node_load5"}
+	if want := map[string][]string{"ring:a": ring, "ring:b": ring, "ring:c": ring}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("expected the missing inputs %v, got %v", want, missing)
+	}
+	if want := []string{"up"}; !reflect.DeepEqual(sets.List(g.leaves["job:b:sum"]), want) {
+		t.Errorf("expected the scraped metrics %v, got %v", want, sets.List(g.leaves["job:b:sum"]))
+	}
+
+	chains := g.chains(sets.New("cluster:node_cpu:sum"))
+	if want := []string{"cluster:node_cpu:sum", "instance:node_cpu:rate5m"}; !reflect.DeepEqual(chains["node_cpu_seconds_total"], want) {
+		t.Errorf("expected the chain %v, got %v", want, chains["node_cpu_seconds_total"])
+	}
+}
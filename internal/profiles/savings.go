@@ -0,0 +1,261 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+const (
+
+	// defaultScrapeInterval is the scrape interval of targets that do not report theirs, which is the default of the
+	// Prometheus Operator.
+	defaultScrapeInterval = 30 * time.Second
+
+	// bytesPerSample is the estimated size of a sample on disk, at the upper end of the 1-2 bytes per sample that
+	// Prometheus documents for its storage.
+	bytesPerSample = 2
+)
+
+// savingsEndpoint is a monitor endpoint within the full scrape, along with the metrics its profile-specific counterpart
+// keeps.
+type savingsEndpoint struct {
+	namespace  string
+	monitor    string
+	scrapePool string
+
+	// keeps returns true if the profile-specific counterpart of the endpoint keeps the metric, exposed by a target with
+	// the given label set.
+	keeps func(metric string, target model.LabelSet) bool
+
+	// err is set if the profile-specific counterpart of the endpoint could not be determined, in which case the
+	// endpoint is projected to keep all metrics.
+	err string
+}
+
+// extractedSavingsEndpoints returns the endpoints of all monitors that have opted-in to the default profile, whose
+// profile-specific counterparts keep the extracted metrics.
+func extractedSavingsEndpoints(ctx context.Context, lister MonitorLister, metrics sets.Set[string]) ([]savingsEndpoint, error) {
+	podMonitors, serviceMonitors, err := FetchMonitorsForProfile(ctx, lister, FullCollectionProfile, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitors for profile %s: %w", FullCollectionProfile, err)
+	}
+	keeps := func(metric string, _ model.LabelSet) bool {
+		return metrics.Has(metric)
+	}
+	var endpoints []savingsEndpoint
+	for _, serviceMonitor := range serviceMonitors.Items {
+		for i := range serviceMonitor.Spec.Endpoints {
+			endpoints = append(endpoints, savingsEndpoint{
+				namespace:  serviceMonitor.GetNamespace(),
+				monitor:    monitoringv1.ServiceMonitorsKind + "/" + serviceMonitor.GetName(),
+				scrapePool: serviceMonitorScrapePool(serviceMonitor, i),
+				keeps:      keeps,
+			})
+		}
+	}
+	for _, podMonitor := range podMonitors.Items {
+		for i := range podMonitor.Spec.PodMetricsEndpoints {
+			endpoints = append(endpoints, savingsEndpoint{
+				namespace:  podMonitor.GetNamespace(),
+				monitor:    monitoringv1.PodMonitorsKind + "/" + podMonitor.GetName(),
+				scrapePool: podMonitorScrapePool(podMonitor, i),
+				keeps:      keeps,
+			})
+		}
+	}
+
+	return endpoints, nil
+}
+
+// implementedSavingsEndpoints returns the endpoints of all monitors that have opted-in to the default profile, whose
+// profile-specific counterparts, named according to the convention that ReportImplementationStatus checks for, keep the
+// metrics that survive their metric relabeling chains.
+func implementedSavingsEndpoints(ctx context.Context, lister MonitorLister, profile *Profile) ([]savingsEndpoint, error) {
+	podMonitors, serviceMonitors, err := FetchMonitorsForProfile(ctx, lister, FullCollectionProfile, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitors for profile %s: %w", FullCollectionProfile, err)
+	}
+	profilePodMonitors, profileServiceMonitors, err := FetchMonitorsForProfile(ctx, lister, profile.Name, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitors for profile %s: %w", profile.Name, err)
+	}
+
+	// relabelings has the metric relabeling chains of the profile-specific monitors, keyed by the namespace and name of
+	// their default counterparts.
+	relabelings := map[string][]endpointRelabeling{}
+	for _, serviceMonitor := range profileServiceMonitors.Items {
+		er, err := extractRelabelingsFromServiceMonitor(serviceMonitor)
+		if err != nil {
+			klog.Warningf("failed to parse metric relabelings of %s/%s: %v", serviceMonitor.GetNamespace(), serviceMonitor.GetName(), err)
+
+			continue
+		}
+		relabelings[monitoringv1.ServiceMonitorsKind+"/"+serviceMonitor.GetNamespace()+"/"+serviceMonitor.GetName()] = er
+	}
+	for _, podMonitor := range profilePodMonitors.Items {
+		er, err := extractRelabelingsFromPodMonitor(podMonitor)
+		if err != nil {
+			klog.Warningf("failed to parse metric relabelings of %s/%s: %v", podMonitor.GetNamespace(), podMonitor.GetName(), err)
+
+			continue
+		}
+		relabelings[monitoringv1.PodMonitorsKind+"/"+podMonitor.GetNamespace()+"/"+podMonitor.GetName()] = er
+	}
+	endpoint := func(kind, namespace, name string, i int, scrapePool string) savingsEndpoint {
+		e := savingsEndpoint{
+			namespace:  namespace,
+			monitor:    kind + "/" + name,
+			scrapePool: scrapePool,
+		}
+		er, ok := relabelings[kind+"/"+namespace+"/"+profile.CounterpartName(name)]
+		if !ok || i >= len(er) {
+			e.err = ErrImplemented
+			e.keeps = func(string, model.LabelSet) bool {
+				return true
+			}
+
+			return e
+		}
+		e.keeps = func(metric string, target model.LabelSet) bool {
+			return er[i].keeps(metric, []model.LabelSet{target})
+		}
+
+		return e
+	}
+
+	var endpoints []savingsEndpoint
+	for _, serviceMonitor := range serviceMonitors.Items {
+		for i := range serviceMonitor.Spec.Endpoints {
+			endpoints = append(endpoints, endpoint(
+				monitoringv1.ServiceMonitorsKind, serviceMonitor.GetNamespace(), serviceMonitor.GetName(), i,
+				serviceMonitorScrapePool(serviceMonitor, i),
+			))
+		}
+	}
+	for _, podMonitor := range podMonitors.Items {
+		for i := range podMonitor.Spec.PodMetricsEndpoints {
+			endpoints = append(endpoints, endpoint(
+				monitoringv1.PodMonitorsKind, podMonitor.GetNamespace(), podMonitor.GetName(), i,
+				podMonitorScrapePool(podMonitor, i),
+			))
+		}
+	}
+
+	return endpoints, nil
+}
+
+// savingsReport projects the savings of the profile over the full scrape, for the targets of every endpoint, and
+// returns them as the savings report. The active series are counted per metric exposed by each target, of which the
+// profile keeps the ones its endpoint keeps. The ingestion rate is derived from the samples that were left after metric
+// relabeling in the last scrape of every target, scaled down in proportion to the series for the profile, and the
+// storage is estimated from the ingestion rate.
+func savingsReport(ctx context.Context, c *client.Client, profile CollectionProfile, endpoints []savingsEndpoint) (*report.Report, error) {
+	targetsResult, err := c.Targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch targets: %w", err)
+	}
+	poolTargets := map[string][]int{}
+	var targets []model.LabelSet
+	var intervals []time.Duration
+	for _, target := range targetsResult.Active {
+		poolTargets[target.ScrapePool] = append(poolTargets[target.ScrapePool], len(targets))
+		targets = append(targets, target.Labels)
+		interval := defaultScrapeInterval
+		if d, err := model.ParseDuration(target.DiscoveredLabels[model.ScrapeIntervalLabel]); err == nil && d > 0 {
+			interval = time.Duration(d)
+		}
+		intervals = append(intervals, interval)
+	}
+	cardinalities := c.EvaluateTargetCardinalities(ctx, targets)
+
+	savings := &report.Savings{}
+	namespaces := map[string]*report.SavingsRow{}
+	monitors := map[string]*report.SavingsRow{}
+	var monitorKeys []string
+	failed := 0
+	for _, e := range endpoints {
+		key := e.namespace + "/" + e.monitor
+		row, ok := monitors[key]
+		if !ok {
+			row = &report.SavingsRow{Namespace: e.namespace, Monitor: e.monitor, Error: e.err}
+			monitors[key] = row
+			monitorKeys = append(monitorKeys, key)
+		}
+		for _, i := range poolTargets[e.scrapePool] {
+			cardinality := cardinalities[i]
+			if cardinality.Err != nil {
+				failed++
+				row.Error = cardinality.Err.Error()
+
+				continue
+			}
+			full, kept := uint64(0), uint64(0)
+			for metric, series := range cardinality.Metrics {
+				full += uint64(series)
+				if e.keeps(metric, cardinality.Target) {
+					kept += uint64(series)
+				}
+			}
+			samplesPerSecond := cardinality.SamplesPerScrape / intervals[i].Seconds()
+			profileSamplesPerSecond := 0.0
+			if full > 0 {
+				profileSamplesPerSecond = samplesPerSecond * float64(kept) / float64(full)
+			}
+			row.FullSeries += full
+			row.ProfileSeries += kept
+			row.FullSamplesPerSecond += samplesPerSecond
+			row.ProfileSamplesPerSecond += profileSamplesPerSecond
+		}
+	}
+	sort.Strings(monitorKeys)
+	for _, key := range monitorKeys {
+		row := monitors[key]
+		row.FullBytesPerDay = bytesPerDay(row.FullSamplesPerSecond)
+		row.ProfileBytesPerDay = bytesPerDay(row.ProfileSamplesPerSecond)
+		savings.Monitors = append(savings.Monitors, *row)
+
+		namespace, ok := namespaces[row.Namespace]
+		if !ok {
+			namespace = &report.SavingsRow{Namespace: row.Namespace}
+			namespaces[row.Namespace] = namespace
+		}
+		addSavings(namespace, row)
+		addSavings(&savings.Total, row)
+	}
+	for _, namespace := range sets.List(sets.KeySet(namespaces)) {
+		savings.Namespaces = append(savings.Namespaces, *namespaces[namespace])
+	}
+	if failed > 0 {
+		klog.Warningf("failed to evaluate the cardinality of %d targets, which are left out of the savings", failed)
+	}
+
+	r := report.New(report.KindSavings, string(profile))
+	r.Savings = savings
+
+	return r, nil
+}
+
+// addSavings adds the savings of row to the ones of total.
+func addSavings(total, row *report.SavingsRow) {
+	total.FullSeries += row.FullSeries
+	total.ProfileSeries += row.ProfileSeries
+	total.FullSamplesPerSecond += row.FullSamplesPerSecond
+	total.ProfileSamplesPerSecond += row.ProfileSamplesPerSecond
+	total.FullBytesPerDay += row.FullBytesPerDay
+	total.ProfileBytesPerDay += row.ProfileBytesPerDay
+}
+
+// bytesPerDay returns the estimated storage needed per day for the given ingestion rate.
+func bytesPerDay(samplesPerSecond float64) uint64 {
+	return uint64(samplesPerSecond * (24 * time.Hour).Seconds() * bytesPerSample)
+}
@@ -0,0 +1,222 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/rexagod/cpv/internal/manifests"
+)
+
+// MonitorLister lists the ServiceMonitors and PodMonitors that match the given label selector.
+type MonitorLister interface {
+	ListServiceMonitors(ctx context.Context, labelSelector string) (*monitoringv1.ServiceMonitorList, error)
+	ListPodMonitors(ctx context.Context, labelSelector string) (*monitoringv1.PodMonitorList, error)
+}
+
+// RulesProvider provides the rule groups that are validated against a profile. *client.Client satisfies this interface
+// with the rules loaded by the Prometheus instance.
+type RulesProvider interface {
+	Rules(ctx context.Context) (v1.RulesResult, error)
+}
+
+// clusterMonitorLister lists monitors from the cluster.
+type clusterMonitorLister struct {
+	dc dynamic.Interface
+}
+
+// NewClusterMonitorLister returns a MonitorLister backed by the cluster that dc points to.
+func NewClusterMonitorLister(dc dynamic.Interface) MonitorLister {
+	return &clusterMonitorLister{dc: dc}
+}
+
+func (l *clusterMonitorLister) ListServiceMonitors(ctx context.Context, labelSelector string) (*monitoringv1.ServiceMonitorList, error) {
+	ul, err := l.dc.Resource(schema.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  monitoringv1.Version,
+		Resource: monitoringv1.ServiceMonitorName,
+	}).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servicemonitors: %w", err)
+	}
+	var serviceMonitors *monitoringv1.ServiceMonitorList
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(ul.UnstructuredContent(), &serviceMonitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert unstructured to servicemonitor: %w", err)
+	}
+
+	return serviceMonitors, nil
+}
+
+func (l *clusterMonitorLister) ListPodMonitors(ctx context.Context, labelSelector string) (*monitoringv1.PodMonitorList, error) {
+	ul, err := l.dc.Resource(schema.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  monitoringv1.Version,
+		Resource: monitoringv1.PodMonitorName,
+	}).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list podmonitors: %w", err)
+	}
+	var podMonitors *monitoringv1.PodMonitorList
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(ul.UnstructuredContent(), &podMonitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert unstructured to podmonitor: %w", err)
+	}
+
+	return podMonitors, nil
+}
+
+// manifestsMonitorLister lists monitors from rendered manifests.
+type manifestsMonitorLister struct {
+	m *manifests.Manifests
+}
+
+// NewManifestsMonitorLister returns a MonitorLister backed by the monitors found within the rendered manifests.
+func NewManifestsMonitorLister(m *manifests.Manifests) MonitorLister {
+	return &manifestsMonitorLister{m: m}
+}
+
+func (l *manifestsMonitorLister) ListServiceMonitors(_ context.Context, labelSelector string) (*monitoringv1.ServiceMonitorList, error) {
+	selector, err := k8slabels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse label selector %q: %w", labelSelector, err)
+	}
+	serviceMonitors := &monitoringv1.ServiceMonitorList{}
+	for _, serviceMonitor := range l.m.ServiceMonitors {
+		if selector.Matches(k8slabels.Set(serviceMonitor.GetLabels())) {
+			serviceMonitors.Items = append(serviceMonitors.Items, serviceMonitor)
+		}
+	}
+
+	return serviceMonitors, nil
+}
+
+func (l *manifestsMonitorLister) ListPodMonitors(_ context.Context, labelSelector string) (*monitoringv1.PodMonitorList, error) {
+	selector, err := k8slabels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse label selector %q: %w", labelSelector, err)
+	}
+	podMonitors := &monitoringv1.PodMonitorList{}
+	for _, podMonitor := range l.m.PodMonitors {
+		if selector.Matches(k8slabels.Set(podMonitor.GetLabels())) {
+			podMonitors.Items = append(podMonitors.Items, podMonitor)
+		}
+	}
+
+	return podMonitors, nil
+}
+
+// clusterRulesProvider provides rules from the PrometheusRules within the cluster.
+type clusterRulesProvider struct {
+	dc            dynamic.Interface
+	namespace     string
+	labelSelector string
+}
+
+// NewClusterRulesProvider returns a RulesProvider backed by the PrometheusRules within the cluster that dc points to,
+// filtered by namespace (all namespaces if empty) and label selector. The location of every group is set to the
+// namespace and name of the PrometheusRule it was defined in.
+func NewClusterRulesProvider(dc dynamic.Interface, namespace, labelSelector string) RulesProvider {
+	return &clusterRulesProvider{dc: dc, namespace: namespace, labelSelector: labelSelector}
+}
+
+func (p *clusterRulesProvider) Rules(ctx context.Context) (v1.RulesResult, error) {
+	ul, err := p.dc.Resource(schema.GroupVersionResource{
+		Group:    monitoring.GroupName,
+		Version:  monitoringv1.Version,
+		Resource: monitoringv1.PrometheusRuleName,
+	}).Namespace(p.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: p.labelSelector,
+	})
+	if err != nil {
+		return v1.RulesResult{}, fmt.Errorf("failed to list prometheusrules: %w", err)
+	}
+	var prometheusRules *monitoringv1.PrometheusRuleList
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(ul.UnstructuredContent(), &prometheusRules)
+	if err != nil {
+		return v1.RulesResult{}, fmt.Errorf("failed to convert unstructured to prometheusrule: %w", err)
+	}
+	rules := v1.RulesResult{}
+	for _, prometheusRule := range prometheusRules.Items {
+		rules.Groups = append(rules.Groups, toRuleGroups(prometheusRule, prometheusRuleLocation(prometheusRule))...)
+	}
+
+	return rules, nil
+}
+
+// manifestsRulesProvider provides rules from the PrometheusRules within rendered manifests.
+type manifestsRulesProvider struct {
+	m             *manifests.Manifests
+	namespace     string
+	labelSelector string
+}
+
+// NewManifestsRulesProvider returns a RulesProvider backed by the PrometheusRules found within the rendered manifests,
+// filtered by namespace (all namespaces if empty) and label selector. The location of every group is set to the
+// manifest it was loaded from.
+func NewManifestsRulesProvider(m *manifests.Manifests, namespace, labelSelector string) RulesProvider {
+	return &manifestsRulesProvider{m: m, namespace: namespace, labelSelector: labelSelector}
+}
+
+func (p *manifestsRulesProvider) Rules(_ context.Context) (v1.RulesResult, error) {
+	selector, err := k8slabels.Parse(p.labelSelector)
+	if err != nil {
+		return v1.RulesResult{}, fmt.Errorf("failed to parse label selector %q: %w", p.labelSelector, err)
+	}
+	rules := v1.RulesResult{}
+	for _, prometheusRule := range p.m.PrometheusRules {
+		if p.namespace != "" && prometheusRule.GetNamespace() != p.namespace {
+			continue
+		}
+		if !selector.Matches(k8slabels.Set(prometheusRule.GetLabels())) {
+			continue
+		}
+		rules.Groups = append(rules.Groups, toRuleGroups(prometheusRule.PrometheusRule, prometheusRule.Path)...)
+	}
+
+	return rules, nil
+}
+
+// prometheusRuleLocation returns the namespaced name of the PrometheusRule, for eg., "openshift-etcd/etcd-rules".
+func prometheusRuleLocation(prometheusRule *monitoringv1.PrometheusRule) string {
+	return prometheusRule.GetNamespace() + "/" + prometheusRule.GetName()
+}
+
+// toRuleGroups converts the groups within a PrometheusRule into the representation used by the Prometheus rules API.
+func toRuleGroups(prometheusRule *monitoringv1.PrometheusRule, file string) []v1.RuleGroup {
+	var groups []v1.RuleGroup
+	for _, group := range prometheusRule.Spec.Groups {
+		ruleGroup := v1.RuleGroup{
+			Name: group.Name,
+			File: file,
+		}
+		for _, rule := range group.Rules {
+			if rule.Record != "" {
+				ruleGroup.Rules = append(ruleGroup.Rules, v1.RecordingRule{
+					Name:  rule.Record,
+					Query: rule.Expr.String(),
+				})
+			} else {
+				ruleGroup.Rules = append(ruleGroup.Rules, v1.AlertingRule{
+					Name:  rule.Alert,
+					Query: rule.Expr.String(),
+				})
+			}
+		}
+		groups = append(groups, ruleGroup)
+	}
+
+	return groups
+}
@@ -0,0 +1,180 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+// telemetryConfigKey is the key that holds the telemetry configuration within the cluster-monitoring-operator's
+// telemetry ConfigMap.
+// Refer: https://github.com/openshift/cluster-monitoring-operator/blob/master/manifests/0000_50_cluster-monitoring-operator_04-config.yaml.
+const telemetryConfigKey = "metrics.yaml"
+
+// telemetryConfig is the telemetry configuration, either as is, or wrapped within a ConfigMap.
+type telemetryConfig struct {
+	Kind    string            `json:"kind"`
+	Data    map[string]string `json:"data"`
+	Matches []string          `json:"matches"`
+}
+
+// telemetryMatch is a series selector within a telemetry configuration, along with where the configuration was loaded
+// from.
+type telemetryMatch struct {
+	location string
+	selector string
+}
+
+// loadTelemetryMatches returns the series selectors within the telemetry configuration at file, and within the
+// ConfigMap (<namespace>/<name>) in the cluster, if set.
+func loadTelemetryMatches(ctx context.Context, dc dynamic.Interface, file, configMap string) ([]telemetryMatch, error) {
+	var matches []telemetryMatch
+	add := func(location string, selectors []string) {
+		for _, selector := range selectors {
+			matches = append(matches, telemetryMatch{location: location, selector: selector})
+		}
+	}
+	if file != "" {
+		buffer, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read telemetry config file: %w", err)
+		}
+		m, err := parseTelemetryConfig(buffer)
+		if err != nil {
+			return nil, err
+		}
+		add(file, m)
+	}
+	if configMap != "" {
+		if dc == nil {
+			return nil, fmt.Errorf("cluster access is required to fetch the telemetry configmap %s", configMap)
+		}
+		namespace, name, found := strings.Cut(configMap, "/")
+		if !found {
+			return nil, fmt.Errorf("expected the telemetry configmap as <namespace>/<name>, got: %s", configMap)
+		}
+		u, err := dc.Resource(schema.GroupVersionResource{
+			Version:  "v1",
+			Resource: "configmaps",
+		}).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get telemetry configmap %s: %w", configMap, err)
+		}
+		raw, found, err := unstructured.NestedString(u.Object, "data", telemetryConfigKey)
+		if err != nil || !found {
+			return nil, fmt.Errorf("expected %s within the telemetry configmap %s", telemetryConfigKey, configMap)
+		}
+		m, err := parseTelemetryConfig([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		add(configMap, m)
+	}
+
+	return matches, nil
+}
+
+// parseTelemetryConfig returns the series selectors within the telemetry configuration.
+func parseTelemetryConfig(buffer []byte) ([]string, error) {
+	config := telemetryConfig{}
+	err := yaml.Unmarshal(buffer, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal telemetry config: %w", err)
+	}
+	if config.Kind == "ConfigMap" {
+		raw, ok := config.Data[telemetryConfigKey]
+		if !ok {
+			return nil, fmt.Errorf("expected %s within the telemetry configmap", telemetryConfigKey)
+		}
+
+		return parseTelemetryConfig([]byte(raw))
+	}
+
+	return config.Matches, nil
+}
+
+// extractMetricsFromTelemetryConfig returns the metrics selected by the series selectors within the telemetry
+// configuration, along with the selectors that select them. Selectors with regex or negative matchers on the metric
+// name are resolved against the metric names known to the Prometheus instance, and the ones without any matcher on the
+// metric name against the names of the series they select.
+func extractMetricsFromTelemetryConfig(ctx context.Context, c *client.Client, dc dynamic.Interface, file, configMap string) (map[string][]report.Provenance, error) {
+	matches, err := loadTelemetryMatches(ctx, dc, file, configMap)
+	if err != nil {
+		return nil, err
+	}
+	provenance := map[string][]report.Provenance{}
+	add := func(metric string, match telemetryMatch) {
+		provenance[metric] = append(provenance[metric], report.Provenance{
+			Source:   string(SourceTelemetry),
+			Location: match.location,
+			Selector: match.selector,
+		})
+	}
+	var knownMetrics model.LabelValues
+	for _, match := range matches {
+		matchers, err := parser.ParseMetricSelector(match.selector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse telemetry selector %q within %s: %w", match.selector, match.location, err)
+		}
+		var nameMatchers []*labels.Matcher
+		for _, matcher := range matchers {
+			if matcher.Name == model.MetricNameLabel {
+				nameMatchers = append(nameMatchers, matcher)
+			}
+		}
+		if len(nameMatchers) == 1 && nameMatchers[0].Type == labels.MatchEqual {
+			add(nameMatchers[0].Value, match)
+
+			continue
+		}
+		if c == nil {
+			klog.Warningf("skipping telemetry selector %q within %s, resolving it requires a Prometheus instance", match.selector, match.location)
+
+			continue
+		}
+
+		// Selectors without a metric name matcher, for eg., {job="etcd"}, select every metric of the series they match.
+		if len(nameMatchers) == 0 {
+			selectedMetrics, _, err := c.LabelValues(ctx, model.MetricNameLabel, []string{match.selector}, time.Time{}, time.Time{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch metric names for telemetry selector %q: %w", match.selector, err)
+			}
+			for _, selectedMetric := range selectedMetrics {
+				add(string(selectedMetric), match)
+			}
+
+			continue
+		}
+
+		// Fetch all metric names known to the Prometheus instance only once, and only if needed.
+		if knownMetrics == nil {
+			knownMetrics, _, err = c.LabelValues(ctx, model.MetricNameLabel, nil, time.Time{}, time.Time{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch metric names: %w", err)
+			}
+		}
+		for _, knownMetric := range knownMetrics {
+			if matchesMetricName(nameMatchers, string(knownMetric)) {
+				add(string(knownMetric), match)
+			}
+		}
+	}
+
+	return provenance, nil
+}
@@ -0,0 +1,73 @@
+package profiles
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rexagod/cpv/internal/fake"
+)
+
+func TestExtractMetricsFromTelemetryConfig(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join("testdata", "telemetry", "metrics.yaml")
+	configMap := "openshift-monitoring/telemetry-config"
+	dc := fake.NewDynamicClient(t, filepath.Join("testdata", "telemetry", "configmap.yaml"))
+
+	// The selectors are all equality matchers on the metric name, so no Prometheus instance is needed to resolve them.
+	provenance, err := extractMetricsFromTelemetryConfig(context.Background(), nil, dc, file, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"up":                     {configMap, file},
+		"kube_pod_status_ready":  {file},
+		"etcd_server_has_leader": {configMap},
+	}
+	got := map[string][]string{}
+	for metric, metricProvenance := range provenance {
+		for _, p := range metricProvenance {
+			got[metric] = append(got[metric], p.Location)
+		}
+		sort.Strings(got[metric])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the locations %v, got %v", want, got)
+	}
+}
+
+func TestExtractMetricsFromTelemetryConfigRegex(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newFakes(t)
+	file := filepath.Join("testdata", "telemetry", "regex.yaml")
+	provenance, err := extractMetricsFromTelemetryConfig(context.Background(), c, nil, file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Selectors without a metric name matcher are resolved to the names of the series they select.
+	want := map[string][]string{
+		"node_cpu_seconds_total":                      {`{__name__=~"node_(cpu|memory)_.+"}`},
+		"node_memory_MemAvailable_bytes":              {`{__name__=~"node_(cpu|memory)_.+"}`},
+		"kube_pod_status_ready":                       {`{__name__=~"kube_pod_.+",__name__!="kube_pod_info"}`},
+		"etcd_server_has_leader":                      {`{job="etcd"}`},
+		"etcd_disk_wal_fsync_duration_seconds_bucket": {`{job="etcd"}`},
+		"etcd_disk_wal_fsync_duration_seconds_sum":    {`{job="etcd"}`},
+		"etcd_disk_wal_fsync_duration_seconds_count":  {`{job="etcd"}`},
+		"up":                                    {`{job="etcd"}`},
+		"scrape_samples_post_metric_relabeling": {`{job="etcd"}`},
+	}
+	got := map[string][]string{}
+	for metric, metricProvenance := range provenance {
+		for _, p := range metricProvenance {
+			got[metric] = append(got[metric], p.Selector)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the selectors %v, got %v", want, got)
+	}
+}
@@ -19,17 +19,33 @@ const (
 	MinimalCollectionProfile CollectionProfile = "minimal"
 )
 
-var (
-	SupportedCollectionProfiles           = CollectionProfiles{FullCollectionProfile, MinimalCollectionProfile}
-	SupportedNonDefaultCollectionProfiles = SupportedCollectionProfiles[1:]
-)
+// SupportedCollectionProfiles returns the names of all registered profiles, in the order they were registered, starting
+// with the default one.
+func SupportedCollectionProfiles() CollectionProfiles {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 
-func IsSupportedCollectionProfile(profile CollectionProfile) bool {
-	for _, p := range SupportedCollectionProfiles {
-		if p == profile {
-			return true
+	return append(CollectionProfiles{}, registrationOrder...)
+}
+
+// SupportedNonDefaultCollectionProfiles returns the names of all registered profiles, other than the default one.
+func SupportedNonDefaultCollectionProfiles() CollectionProfiles {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var nonDefault CollectionProfiles
+	for _, name := range registrationOrder {
+		if !registry[name].IsDefault() {
+			nonDefault = append(nonDefault, name)
 		}
 	}
 
-	return false
+	return nonDefault
+}
+
+func IsSupportedCollectionProfile(profile CollectionProfile) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[profile]
+
+	return ok
 }
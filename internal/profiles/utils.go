@@ -2,47 +2,24 @@ package profiles
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"strings"
-	"sync"
 
-	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
+	"github.com/prometheus/prometheus/promql/parser"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
 	ErrImplemented           = "not implemented"
 	ErrLoaded                = "not loaded"
+	ErrDropped               = "dropped by the profile"
+	ErrMissingInput          = "missing input"
+	ErrCycle                 = "dependency cycle"
+	ErrNotExtracted          = "not required by any source"
 	CtxGeneratedManifestsKey = "generatedManifests"
 )
 
-type Recorder struct {
-	file                 *os.File
-	m                    sync.Mutex
-	loadIssues           *uint
-	implementationIssues *uint
-}
-
-func (r *Recorder) Write(p []byte) (n int, err error) {
-	r.m.Lock()
-	defer r.m.Unlock()
-	if r.loadIssues != nil && strings.Contains(string(p), ErrLoaded) {
-		*r.loadIssues++
-	}
-	if r.implementationIssues != nil && strings.Contains(string(p), ErrImplemented) {
-		*r.implementationIssues++
-	}
-
-	// nolint:wrapcheck
-	return r.file.Write(p)
-}
-
-func fetchServiceMonitorsForProfile(ctx context.Context, dc *dynamic.DynamicClient, profile CollectionProfile, noisy bool) (*monitoringv1.ServiceMonitorList, error) {
+// profileLabelSelector returns the label selector for monitors that implement the specified profile.
+func profileLabelSelector(profile CollectionProfile, noisy bool) string {
 	var labelSelector string
 	interpretAbsentCPLabelAsFull := noisy && profile == FullCollectionProfile
 	if !interpretAbsentCPLabelAsFull {
@@ -51,61 +28,19 @@ func fetchServiceMonitorsForProfile(ctx context.Context, dc *dynamic.DynamicClie
 			labelSelector = labelSelector + "=" + string(profile)
 		}
 	}
-	l, err := dc.Resource(schema.GroupVersionResource{
-		Group:    monitoring.GroupName,
-		Version:  monitoringv1.Version,
-		Resource: monitoringv1.ServiceMonitorName,
-	}).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list servicemonitors: %w", err)
-	}
-	var serviceMonitors *monitoringv1.ServiceMonitorList
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(l.UnstructuredContent(), &serviceMonitors)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert unstructured to servicemonitor: %w", err)
-	}
 
-	return serviceMonitors, nil
+	return labelSelector
 }
 
-func fetchPodMonitorsForProfile(ctx context.Context, dc *dynamic.DynamicClient, profile CollectionProfile, noisy bool) (*monitoringv1.PodMonitorList, error) {
-	var labelSelector string
-	interpretAbsentCPLabelAsFull := noisy && profile == FullCollectionProfile
-	if !interpretAbsentCPLabelAsFull {
-		labelSelector = CollectionProfileOptInLabel
-		if profile != "" {
-			labelSelector = labelSelector + "=" + string(profile)
-		}
-	}
-	l, err := dc.Resource(schema.GroupVersionResource{
-		Group:    monitoring.GroupName,
-		Version:  monitoringv1.Version,
-		Resource: monitoringv1.PodMonitorName,
-	}).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list podmonitors: %w", err)
-	}
-	var podMonitors *monitoringv1.PodMonitorList
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(l.UnstructuredContent(), &podMonitors)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert unstructured to podmonitor: %w", err)
-	}
-
-	return podMonitors, nil
-}
-
-// fetchMonitorsForProfile returns pod and service monitors that implement the specified profile, leave it out to get
+// FetchMonitorsForProfile returns pod and service monitors that implement the specified profile, leave it out to get
 // monitors for all profiles.
-func fetchMonitorsForProfile(ctx context.Context, dc *dynamic.DynamicClient, profile CollectionProfile, noisy bool) (*monitoringv1.PodMonitorList, *monitoringv1.ServiceMonitorList, error) {
-	podMonitors, err := fetchPodMonitorsForProfile(ctx, dc, profile, noisy)
+func FetchMonitorsForProfile(ctx context.Context, lister MonitorLister, profile CollectionProfile, noisy bool) (*monitoringv1.PodMonitorList, *monitoringv1.ServiceMonitorList, error) {
+	labelSelector := profileLabelSelector(profile, noisy)
+	podMonitors, err := lister.ListPodMonitors(ctx, labelSelector)
 	if err != nil {
 		return nil, nil, err
 	}
-	serviceMonitors, err := fetchServiceMonitorsForProfile(ctx, dc, profile, noisy)
+	serviceMonitors, err := lister.ListServiceMonitors(ctx, labelSelector)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -113,38 +48,18 @@ func fetchMonitorsForProfile(ctx context.Context, dc *dynamic.DynamicClient, pro
 	return podMonitors, serviceMonitors, nil
 }
 
-func extractMetricsExpressionsFromServiceMonitor(serviceMonitor *monitoringv1.ServiceMonitor) string {
-	var metricsExpressions []string
-	for _, endpoint := range serviceMonitor.Spec.Endpoints {
-		for _, metricRelabelConfig := range endpoint.MetricRelabelConfigs {
-			action := metricRelabelConfig.Action
-			sourceLabels := metricRelabelConfig.SourceLabels
-			if action == "keep" && len(sourceLabels) == 1 && sourceLabels[0] == "__name__" {
-				regex := metricRelabelConfig.Regex
-				regex, _ = strings.CutPrefix(regex, "(")
-				regex, _ = strings.CutSuffix(regex, ")")
-				metricsExpressions = append(metricsExpressions, regex)
+// extractMetricsFromExpr returns the names of all metrics selected within the expression.
+func extractMetricsFromExpr(expr parser.Expr) sets.Set[string] {
+	metrics := sets.Set[string]{}
+	parser.Inspect(
+		expr, func(node parser.Node, path []parser.Node) error {
+			if n, ok := node.(*parser.VectorSelector); ok && n.Name != "" {
+				metrics.Insert(n.Name)
 			}
-		}
-	}
-
-	return strings.Join(metricsExpressions, "|")
-}
 
-func extractMetricsExpressionsFromPodMonitor(podMonitor *monitoringv1.PodMonitor) string {
-	var metricsExpressions []string
-	for _, endpoint := range podMonitor.Spec.PodMetricsEndpoints {
-		for _, metricRelabelConfig := range endpoint.MetricRelabelConfigs {
-			action := metricRelabelConfig.Action
-			sourceLabels := metricRelabelConfig.SourceLabels
-			if action == "keep" && len(sourceLabels) == 1 && sourceLabels[0] == "__name__" {
-				regex := metricRelabelConfig.Regex
-				regex, _ = strings.CutPrefix(regex, "(")
-				regex, _ = strings.CutSuffix(regex, ")")
-				metricsExpressions = append(metricsExpressions, regex)
-			}
-		}
-	}
+			return nil
+		},
+	)
 
-	return strings.Join(metricsExpressions, "|")
+	return metrics
 }
@@ -0,0 +1,394 @@
+// Package report contains the versioned schema of the reports generated by the validation, extraction, status,
+// savings and explanation operations, and renders them in all supported output formats.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// APIVersion is the version of the report schema. It must be bumped on any backwards incompatible change.
+const APIVersion = "cpv/v1alpha1"
+
+// Format is the format the reports are rendered in.
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+)
+
+// SupportedFormats are all the formats the reports may be rendered in.
+var SupportedFormats = []Format{FormatTable, FormatJSON, FormatYAML}
+
+// IsSupportedFormat returns true if the reports may be rendered in the given format.
+func IsSupportedFormat(format Format) bool {
+	for _, f := range SupportedFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Extension returns the file extension for the format.
+func (f Format) Extension() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatYAML:
+		return "yaml"
+	default:
+		return "log"
+	}
+}
+
+// Kind is the kind of operation a report was generated by.
+type Kind string
+
+const (
+	KindValidation  Kind = "ValidationReport"
+	KindExtraction  Kind = "ExtractionReport"
+	KindStatus      Kind = "StatusReport"
+	KindSavings     Kind = "SavingsReport"
+	KindExplanation Kind = "ExplanationReport"
+)
+
+// Report is the result of an operation. Only the fields relevant to its Kind are set.
+type Report struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       Kind   `json:"kind"`
+	Profile    string `json:"profile,omitempty"`
+
+	// Discrepancies are the metrics that the rules depend on, which are either not loaded while a profile-specific
+	// monitor depends on them, or dropped by all profile-specific monitors (validation).
+	Discrepancies []Discrepancy `json:"discrepancies,omitempty"`
+
+	// Status is the implementation status of the profile-specific monitors (status).
+	Status []StatusRow `json:"status,omitempty"`
+
+	// Metrics are the extracted metrics (extraction), or the explained one (explanation).
+	Metrics []Metric `json:"metrics,omitempty"`
+
+	// RuleDependencies are the issues encountered while resolving recording rules (extraction).
+	RuleDependencies []RuleDependency `json:"ruleDependencies,omitempty"`
+
+	// LabelDrops are the labels that nothing references on any of the extracted metrics, which may be dropped without
+	// making their series collide (extraction).
+	LabelDrops []string `json:"labelDrops,omitempty"`
+
+	// Savings are the projected savings of the profile over the full scrape (savings).
+	Savings *Savings `json:"savings,omitempty"`
+}
+
+// Discrepancy is a metric used within a rule that is not loaded, while a monitor endpoint depends on it, or that no
+// monitor endpoint keeps, in which case Monitor and Endpoint are not set.
+type Discrepancy struct {
+	Monitor  string `json:"monitor,omitempty"`
+	Endpoint *int   `json:"endpoint,omitempty"`
+	Group    string `json:"group,omitempty"`
+	File     string `json:"file,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Query    string `json:"query,omitempty"`
+	Metric   string `json:"metric,omitempty"`
+	Error    string `json:"error"`
+}
+
+// StatusRow is a default monitor that lacks its profile-specific counterpart.
+type StatusRow struct {
+	Profile        string `json:"profile"`
+	ServiceMonitor string `json:"serviceMonitor,omitempty"`
+	PodMonitor     string `json:"podMonitor,omitempty"`
+	Error          string `json:"error"`
+}
+
+// Metric is an extracted metric, along with its cardinality, if evaluated, or the error encountered while evaluating
+// it.
+type Metric struct {
+	Name        string `json:"name"`
+	Cardinality *uint  `json:"cardinality,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// Range is the cardinality over the lookback window, if evaluated.
+	Range *CardinalityRange `json:"range,omitempty"`
+
+	// AbsentNow is true if the metric had series within the lookback window, but has none at the current time.
+	AbsentNow bool `json:"absentNow,omitempty"`
+
+	// Labels are the labels of the metric, along with their cardinality, if broken down.
+	Labels []Label `json:"labels,omitempty"`
+
+	// Provenance has where the metric was found, i.e., why it is extracted.
+	Provenance []Provenance `json:"provenance,omitempty"`
+}
+
+// Provenance is where a source found a metric that it requires. Only the fields relevant to its Source are set.
+type Provenance struct {
+	Source string `json:"source"`
+
+	// Location is the file, ConfigMap or selector that the metric was found within.
+	Location string `json:"location"`
+
+	// Group and Rule are the rule group and the rule that depend on the metric (rules).
+	Group string `json:"group,omitempty"`
+	Rule  string `json:"rule,omitempty"`
+
+	// Chain has the names recorded by recording rules, that lead from the rule to the metric, in order (rules).
+	Chain []string `json:"chain,omitempty"`
+
+	// Dashboard and Panel are the titles of the dashboard and the panel, or the name of the templating variable, that
+	// query the metric (dashboards).
+	Dashboard string `json:"dashboard,omitempty"`
+	Panel     string `json:"panel,omitempty"`
+
+	// Selector is the series selector that selects the metric (telemetry).
+	Selector string `json:"selector,omitempty"`
+}
+
+// ReferencedBy returns what references the metric within the location, followed by the recorded names that lead to the
+// metric, if any.
+func (p Provenance) ReferencedBy() string {
+	var referencedBy string
+	switch {
+	case p.Rule != "":
+		referencedBy = p.Group + "/" + p.Rule
+	case p.Panel != "":
+		referencedBy = p.Dashboard + "/" + p.Panel
+	case p.Selector != "":
+		referencedBy = p.Selector
+	}
+	for _, recorded := range p.Chain {
+		referencedBy += " -> " + recorded
+	}
+
+	return referencedBy
+}
+
+// Label is a label of a metric, along with its number of distinct values, and whether anything references it.
+type Label struct {
+	Name        string `json:"name"`
+	Cardinality uint   `json:"cardinality"`
+	Referenced  bool   `json:"referenced"`
+}
+
+// CardinalityRange summarizes the cardinality of a metric at every step of the lookback window.
+type CardinalityRange struct {
+	Min uint    `json:"min"`
+	Avg float64 `json:"avg"`
+	Max uint    `json:"max"`
+	P95 uint    `json:"p95"`
+}
+
+// RuleDependency is a recording rule whose inputs are absent, or that is part of a dependency cycle.
+type RuleDependency struct {
+	RecordingRule string   `json:"recordingRule"`
+	Group         string   `json:"group,omitempty"`
+	File          string   `json:"file,omitempty"`
+	Metrics       []string `json:"metrics"`
+	Error         string   `json:"error"`
+}
+
+// Savings are the projected savings of a profile, broken down per monitor and per namespace.
+type Savings struct {
+	Monitors   []SavingsRow `json:"monitors"`
+	Namespaces []SavingsRow `json:"namespaces"`
+	Total      SavingsRow   `json:"total"`
+}
+
+// SavingsRow compares the active series, ingestion rate and estimated storage of the full scrape, against the ones of
+// the profile.
+type SavingsRow struct {
+	Namespace               string  `json:"namespace,omitempty"`
+	Monitor                 string  `json:"monitor,omitempty"`
+	FullSeries              uint64  `json:"fullSeries"`
+	ProfileSeries           uint64  `json:"profileSeries"`
+	FullSamplesPerSecond    float64 `json:"fullSamplesPerSecond"`
+	ProfileSamplesPerSecond float64 `json:"profileSamplesPerSecond"`
+	FullBytesPerDay         uint64  `json:"fullBytesPerDay"`
+	ProfileBytesPerDay      uint64  `json:"profileBytesPerDay"`
+	Error                   string  `json:"error,omitempty"`
+}
+
+// SavedSeries returns the percentage of series that the profile saves.
+func (s SavingsRow) SavedSeries() float64 {
+	if s.FullSeries == 0 {
+		return 0
+	}
+
+	return 100 * float64(s.FullSeries-s.ProfileSeries) / float64(s.FullSeries)
+}
+
+// New returns an empty report of the given kind.
+func New(kind Kind, profile string) *Report {
+	return &Report{
+		APIVersion: APIVersion,
+		Kind:       kind,
+		Profile:    profile,
+	}
+}
+
+// Write renders the report in the given format.
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		//nolint:wrapcheck
+		return encoder.Encode(r)
+	case FormatYAML:
+		b, err := yaml.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		_, err = w.Write(b)
+
+		//nolint:wrapcheck
+		return err
+	case FormatTable:
+		return r.writeTable(w)
+	}
+
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+func (r *Report) writeTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	switch r.Kind {
+	case KindValidation:
+		_, _ = fmt.Fprintf(w, "%s MONITOR\tENDPOINT\tGROUP\tLOCATION\tRULE\tQUERY\tMETRIC\tERROR\n", strings.ToUpper(r.Profile))
+		for _, d := range r.Discrepancies {
+			endpoint := ""
+			if d.Endpoint != nil {
+				endpoint = strconv.Itoa(*d.Endpoint)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Monitor, endpoint, d.Group, d.File, d.Rule, d.Query, d.Metric, d.Error)
+		}
+	case KindStatus:
+		_, _ = fmt.Fprintln(w, "PROFILE\tSERVICE MONITOR\tPOD MONITOR\tERROR")
+		for _, s := range r.Status {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Profile, s.ServiceMonitor, s.PodMonitor, s.Error)
+		}
+	case KindExtraction:
+		hasRange := false
+		for _, m := range r.Metrics {
+			hasRange = hasRange || m.Range != nil
+		}
+		if hasRange {
+			_, _ = fmt.Fprintln(w, "METRIC\tCARDINALITY\tMIN\tAVG\tMAX\tP95\tABSENT NOW\tERROR")
+		} else {
+			_, _ = fmt.Fprintln(w, "METRIC\tCARDINALITY\tERROR")
+		}
+		for _, m := range r.Metrics {
+			cardinality := ""
+			if m.Cardinality != nil {
+				cardinality = strconv.FormatUint(uint64(*m.Cardinality), 10)
+			}
+			if !hasRange {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, cardinality, m.Error)
+
+				continue
+			}
+			var cardinalityRange [4]string
+			if m.Range != nil {
+				cardinalityRange = [4]string{
+					strconv.FormatUint(uint64(m.Range.Min), 10),
+					strconv.FormatFloat(m.Range.Avg, 'f', 2, 64),
+					strconv.FormatUint(uint64(m.Range.Max), 10),
+					strconv.FormatUint(uint64(m.Range.P95), 10),
+				}
+			}
+			absentNow := ""
+			if m.AbsentNow {
+				absentNow = "true"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Name, cardinality,
+				cardinalityRange[0], cardinalityRange[1], cardinalityRange[2], cardinalityRange[3], absentNow, m.Error)
+		}
+		hasLabels := false
+		for _, m := range r.Metrics {
+			hasLabels = hasLabels || len(m.Labels) > 0
+		}
+		if hasLabels {
+			_, _ = fmt.Fprintln(w, "\nMETRIC\tLABEL\tCARDINALITY\tREFERENCED")
+			for _, m := range r.Metrics {
+				for _, l := range m.Labels {
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%t\n", m.Name, l.Name, l.Cardinality, l.Referenced)
+				}
+			}
+		}
+		r.writeProvenance(w)
+		if len(r.LabelDrops) > 0 {
+			_, _ = fmt.Fprintln(w, "\nSUGGESTED LABELDROP")
+			for _, l := range r.LabelDrops {
+				_, _ = fmt.Fprintln(w, l)
+			}
+		}
+		if len(r.RuleDependencies) > 0 {
+			_, _ = fmt.Fprintln(w, "\nRECORDING RULE\tGROUP\tFILE\tMETRICS\tERROR")
+			for _, d := range r.RuleDependencies {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.RecordingRule, d.Group, d.File, strings.Join(d.Metrics, ","), d.Error)
+			}
+		}
+	case KindExplanation:
+		for i, m := range r.Metrics {
+			if i == 0 && m.Error != "" {
+				_, _ = fmt.Fprintln(w, "METRIC\tERROR")
+			}
+			if m.Error != "" {
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", m.Name, m.Error)
+			}
+		}
+		r.writeProvenance(w)
+	case KindSavings:
+		if r.Savings == nil {
+			break
+		}
+		profile := strings.ToUpper(r.Profile)
+		_, _ = fmt.Fprintf(w, "NAMESPACE\tMONITOR\tFULL SERIES\t%[1]s SERIES\tSAVED\tFULL SAMPLES/S\t%[1]s SAMPLES/S\tFULL BYTES/DAY\t%[1]s BYTES/DAY\tERROR\n", profile)
+		for _, rows := range [][]SavingsRow{r.Savings.Monitors, r.Savings.Namespaces, {r.Savings.Total}} {
+			for _, s := range rows {
+				namespace := s.Namespace
+				if s.Namespace == "" && s.Monitor == "" {
+					namespace = "TOTAL"
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\t%.2f\t%.2f\t%d\t%d\t%s\n",
+					namespace, s.Monitor, s.FullSeries, s.ProfileSeries, s.SavedSeries(), s.FullSamplesPerSecond,
+					s.ProfileSamplesPerSecond, s.FullBytesPerDay, s.ProfileBytesPerDay, s.Error)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported report kind: %s", r.Kind)
+	}
+
+	//nolint:wrapcheck
+	return w.Flush()
+}
+
+// writeProvenance writes the provenance of all metrics, if any.
+func (r *Report) writeProvenance(w io.Writer) {
+	hasProvenance := false
+	for _, m := range r.Metrics {
+		hasProvenance = hasProvenance || len(m.Provenance) > 0
+	}
+	if !hasProvenance {
+		return
+	}
+	if r.Kind != KindExplanation {
+		_, _ = fmt.Fprintln(w)
+	}
+	_, _ = fmt.Fprintln(w, "METRIC\tSOURCE\tLOCATION\tREFERENCED BY")
+	for _, m := range r.Metrics {
+		for _, p := range m.Provenance {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, p.Source, p.Location, p.ReferencedBy())
+		}
+	}
+}
@@ -2,156 +2,437 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 	"time"
 
-	"github.com/go-stack/stack"
+	"github.com/prometheus/common/config"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 
 	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/manifests"
 	"github.com/rexagod/cpv/internal/options"
+	"github.com/rexagod/cpv/internal/output"
 	"github.com/rexagod/cpv/internal/profiles"
+	"github.com/rexagod/cpv/internal/report"
+	v "github.com/rexagod/cpv/internal/version"
 )
 
-const (
-	contextTimeout    = 5 * time.Minute
-	invalidProfileErr = "invalid profile: %s"
-)
+const contextTimeout = 5 * time.Minute
 
-func main() {
+// sources are the sources of monitors and rules.
+type sources struct {
+	lister        profiles.MonitorLister
+	rulesProvider profiles.RulesProvider
+	dc            dynamic.Interface
+}
 
-	// Get options.
-	o := options.NewOptions()
+func main() {
 
-	// Check if the endpoint at -address is up.
-	err := o.IsUp()
+	// Get options for the subcommand.
+	o, err := options.NewOptions(os.Args[1:])
 	if err != nil {
-		klog.Fatal(err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if !errors.Is(err, options.ErrUsage) {
+			klog.Error(err)
+		}
+		os.Exit(1)
 	}
 
-	// Create a new client.
 	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
 	defer cancel()
-	c := client.NewClient(ctx, o.Address, o.BearerToken)
-	if err := c.Init(); err != nil {
-		klog.Fatal(err)
+
+	// Write all generated artifacts to the output directory, or stdout.
+	w := output.NewWriter(o.OutputDir, o.Stdout, report.Format(o.OutputFormat))
+
+	switch o.Command {
+	case options.CommandExtract:
+		err = extract(ctx, o, w)
+	case options.CommandExplain:
+		err = explain(ctx, o)
+	case options.CommandStatus:
+		err = status(ctx, o, w)
+	case options.CommandValidate:
+		err = validate(ctx, o, w)
+	case options.CommandVersion:
+		v.Println()
 	}
+	if err != nil {
+		klog.Error(err)
+	}
+	failed := err != nil
 
-	// Create a new Kube client.
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", o.KubeconfigPath)
+	// If quiet mode is enabled, open all generated manifests in $EDITOR.
+	if o.Quiet {
+		klog.Flush()
+		files := w.Files()
+		if len(files) > 0 {
+			editor := os.Getenv("EDITOR")
+			editorPath, err := exec.Command("which", editor).Output()
+			if err != nil {
+				panic(err)
+			}
+			// gosec complains if the args are not hardcoded.
+			// nolint:gosec
+			cmd := exec.Command(strings.Trim(string(editorPath), "\n"), files...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			cmd.Stdin = os.Stdin
+			err = cmd.Run()
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	if failed {
+		klog.Flush()
+		os.Exit(1)
+	}
+}
+
+// extract calls the profile-specific extractor to extract the metrics needed to implement the respective profile.
+func extract(ctx context.Context, o *options.Options, w *output.Writer) error {
+	e, err := profiles.ProfileExtractor(profiles.CollectionProfile(o.Profile))
 	if err != nil {
-		klog.Fatal(err)
+		//nolint:wrapcheck
+		return err
+	}
+
+	// The Prometheus instance is optional when extracting from local sources alone, so that it may run offline.
+	var c *client.Client
+	if o.NeedsPrometheus() {
+		c = newClient(ctx, o)
+		c.SetCardinalityOptions(o.Cardinality)
+	}
+
+	// Monitors are only needed to generate the profile-specific ones, so the cluster is optional here.
+	var s sources
+	if o.HasCluster() {
+		s = newSources(o, c)
 	}
-	dc, err := dynamic.NewForConfig(kubeconfig)
+
+	request := profiles.ExtractRequest{
+		Sources:           metricSources(o, s.dc),
+		Lister:            s.lister,
+		OutputCardinality: o.OutputCardinality,
+		LabelCardinality:  o.LabelCardinality,
+		Savings:           o.Savings,
+	}
+	result, err := e.Extract(ctx, c, request)
 	if err != nil {
-		klog.Fatal(err)
+		//nolint:wrapcheck
+		return err
 	}
 
-	// Track if any operation was performed based on the given inputs.
-	didOp := false
+	return writeExtractResult(w, o.Profile, result)
+}
 
-	// Call profile-specific operator to validate the respective profile.
-	if o.Profile != "" && o.Validate {
-		didOp = true
-		p := profiles.CollectionProfile(o.Profile)
-		if !profiles.IsSupportedCollectionProfile(p) {
-			klog.Fatalf(invalidProfileErr, p)
-		}
-		err = profiles.ProfileOperators[p].Operator(
-			ctx,
-			dc,
-			c,
-			o.Noisy,
-		)
-		if err != nil {
-			klog.Error(err)
-		}
+// explain prints where the sources of the profile found the metric, i.e., why it is extracted.
+func explain(ctx context.Context, o *options.Options) error {
+	e, err := profiles.ProfileExtractor(profiles.CollectionProfile(o.Profile))
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	var c *client.Client
+	if o.NeedsPrometheus() {
+		c = newClient(ctx, o)
+	}
+
+	// The cluster is only needed to fetch the -telemetry-configmap.
+	var s sources
+	if o.HasCluster() {
+		s = newSources(o, c)
+	}
+	r, err := e.Explain(ctx, c, metricSources(o, s.dc), o.Metric)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
 	}
 
-	// Call profile-specific extractor to extract the metrics needed to implement the respective profile.
-	if o.Profile != "" && o.HasExtractor() {
-		didOp = true
-		p := profiles.CollectionProfile(o.Profile)
-		if !profiles.IsSupportedCollectionProfile(p) {
-			klog.Fatalf(invalidProfileErr, p)
+	//nolint:wrapcheck
+	return r.Write(os.Stdout, report.Format(o.OutputFormat))
+}
+
+// metricSources returns the sources of the metrics a profile requires, for the inputs that are set.
+func metricSources(o *options.Options, dc dynamic.Interface) []profiles.MetricSource {
+	var all []profiles.MetricSource
+	if o.AllowListFile != "" {
+		all = append(all, profiles.NewAllowListSource(o.AllowListFile))
+	}
+	if o.RuleFile != "" {
+		all = append(all, profiles.NewRuleFilesSource(strings.Split(o.RuleFile, ",")))
+	}
+	if o.Dashboards != "" {
+		all = append(all, profiles.NewDashboardsSource(strings.Split(o.Dashboards, ",")))
+	}
+	if o.TelemetryConfigFile != "" || o.TelemetryConfigMap != "" {
+		all = append(all, profiles.NewTelemetrySource(dc, o.TelemetryConfigFile, o.TelemetryConfigMap))
+	}
+	if o.TargetSelectors != "" {
+		all = append(all, profiles.NewTargetsSource(o.TargetSelectors))
+	}
+
+	return all
+}
+
+// writeExtractResult writes the artifacts of the extraction for the profile.
+func writeExtractResult(w *output.Writer, profile string, result *profiles.ExtractResult) error {
+	reportFile, err := w.WriteReport(fmt.Sprintf("%s-extraction-report", profile), result.Report)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	if len(result.Report.RuleDependencies) > 0 {
+		klog.Infof("encountered %d rule dependency issues%s", len(result.Report.RuleDependencies), refer(reportFile))
+	} else {
+		klog.Infof("extraction report written%s", refer(reportFile))
+	}
+	if result.LabelDropConfig != "" {
+		file, err := w.WriteString(fmt.Sprintf("%s-labeldrop-config.yaml", profile), result.LabelDropConfig)
+		if err != nil {
+			//nolint:wrapcheck
+			return err
 		}
-		err = profiles.ProfileExtractors[p].Extract(
-			ctx,
-			c,
-			o.AllowListFile,
-			o.RuleFile,
-			o.TargetSelectors,
-			o.OutputCardinality,
-		)
+		klog.Infof("%d labels may be dropped%s", len(result.Report.LabelDrops), refer(file))
+	}
+	relabelConfigFile, err := w.WriteString(fmt.Sprintf("%s-relabel-config.yaml", profile), result.RelabelConfig)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	klog.Infof("relabel config written%s", refer(relabelConfigFile))
+	if len(result.Monitors) > 0 {
+		monitorsFile, err := w.WriteString(fmt.Sprintf("%s-monitors.yaml", profile), strings.Join(result.Monitors, "---\n"))
 		if err != nil {
-			klog.Error(err)
+			//nolint:wrapcheck
+			return err
 		}
+		klog.Infof("monitors written%s", refer(monitorsFile))
 	}
 
-	// Report implementation status for all supported profiles, or a particular one if specified.
-	if o.Status {
-		didOp = true
-		p := profiles.CollectionProfile(o.Profile)
-		if !profiles.IsSupportedCollectionProfile(p) && p != "" {
-			klog.Fatalf(invalidProfileErr, p)
-		}
-		err = profiles.ReportImplementationStatus(
-			ctx,
-			dc,
-			p,
-			o.Noisy,
-		)
-		if err != nil {
-			klog.Error(err)
+	return writeSavings(w, profile, result.Savings)
+}
+
+// status reports the implementation status for all supported profiles, or a particular one if specified.
+func status(ctx context.Context, o *options.Options, w *output.Writer) error {
+	p := profiles.CollectionProfile(o.Profile)
+	if p != "" {
+		if _, err := profiles.LookupProfile(p); err != nil {
+			//nolint:wrapcheck
+			return err
 		}
 	}
+	s := newSources(o, nil)
+	r, err := profiles.ReportImplementationStatus(ctx, s.lister, p, o.Noisy)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
 
-	// If no operation was performed, print usage.
-	if !didOp {
-		flag.Usage()
-		os.Exit(1)
+	// Always write the implementation status, so that consecutive runs may be diffed.
+	name := "implementation-status"
+	if p != "" {
+		name = o.Profile + "-" + name
+	}
+	file, err := w.WriteReport(name, r)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	if len(r.Status) > 0 {
+		klog.Infof("encountered %d issues%s", len(r.Status), refer(file))
 	}
 
-	// If quiet mode is enabled, open all generated manifests in $EDITOR.
-	if o.Quiet {
-		klog.Flush()
-		klogFileName := flag.Lookup("log_file").Value.String()
-		if klogFileName == "" {
-			panic(fmt.Errorf("failed to lookup log_file: %s", stack.Trace()))
-		}
-		raw, err := os.ReadFile(klogFileName)
+	return nil
+}
+
+// validate calls the profile-specific operator to validate the respective profile.
+func validate(ctx context.Context, o *options.Options, w *output.Writer) error {
+	op, err := profiles.ProfileOperator(profiles.CollectionProfile(o.Profile))
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	// The Prometheus instance is optional when validating the rendered manifests, so that it may run offline.
+	var c *client.Client
+	if o.NeedsPrometheus() {
+		c = newClient(ctx, o)
+	}
+	s := newSources(o, c)
+	if s.rulesProvider == nil {
+		return errors.New("no rules to validate against, set -prometheusrules, -manifests-dir, or a Prometheus instance")
+	}
+	result, err := op.Operator(
+		ctx,
+		s.lister,
+		s.rulesProvider,
+		c,
+		o.Noisy,
+		o.Savings,
+	)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	// Always write the validation report, so that consecutive runs may be diffed.
+	file, err := w.WriteReport(fmt.Sprintf("%s-validation-report", o.Profile), result.Report)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	err = writeSavings(w, o.Profile, result.Savings)
+	if err != nil {
+		return err
+	}
+
+	// Fail on discrepancies, so that CI may gate on the validation.
+	if len(result.Report.Discrepancies) > 0 {
+		return fmt.Errorf("encountered %d issues%s", len(result.Report.Discrepancies), refer(file))
+	}
+
+	return nil
+}
+
+// writeSavings writes the savings report for the profile, if projected.
+func writeSavings(w *output.Writer, profile string, r *report.Report) error {
+	if r == nil {
+		return nil
+	}
+	file, err := w.WriteReport(fmt.Sprintf("%s-savings-report", profile), r)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	klog.Infof("projected savings of %.1f%% series%s", r.Savings.Total.SavedSeries(), refer(file))
+
+	return nil
+}
+
+// refer returns a reference to the file an artifact was written to, for the logs, or nothing if it was written to
+// stdout.
+func refer(file string) string {
+	if file == "" {
+		return ""
+	}
+
+	return ", refer: " + file
+}
+
+// newClient returns a client for the Prometheus instance at -address, or the -prometheus-service, once it is ready.
+func newClient(ctx context.Context, o *options.Options) *client.Client {
+
+	// Create a new client.
+	httpConfig, err := o.HTTPClientConfig()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	address := o.Address
+	var c *client.Client
+	if o.PrometheusService != "" {
+		service, err := client.ParseService(o.PrometheusService)
 		if err != nil {
-			panic(err)
+			klog.Fatal(err)
 		}
-		r := regexp.MustCompile(`refer: (.*)\b`)
-		matches := r.FindAllStringSubmatch(string(raw), -1)
-		if len(matches) > 0 {
-			var captureGroups []string
-			for _, match := range matches {
-				captureGroups = append(captureGroups, match[1])
-			}
-			editor := os.Getenv("EDITOR")
-			editorPath, err := exec.Command("which", editor).Output()
+		kubeconfig := restConfig(o)
+		switch client.ServiceMode(o.PrometheusServiceMode) {
+		case client.ServiceModeProxy:
+			c, err = client.NewServiceProxyClient(ctx, kubeconfig, service, o.RequestOptions())
 			if err != nil {
-				panic(err)
+				klog.Fatal(err)
 			}
-			// gosec complains if the args are not hardcoded.
-			// nolint:gosec
-			cmd := exec.Command(strings.Trim(string(editorPath), "\n"), captureGroups...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Stdin = os.Stdin
-			err = cmd.Run()
+		case client.ServiceModePortForward:
+			address, _, err = client.PortForward(ctx, kubeconfig, service)
 			if err != nil {
-				panic(err)
+				klog.Fatal(err)
+			}
+			klog.Infof("forwarding %s to %s", address, service)
+
+			// Authenticate with the kubeconfig's credentials, unless others were given, and verify the certificate
+			// against the service's in-cluster name.
+			if httpConfig.Authorization == nil && httpConfig.BasicAuth == nil && httpConfig.OAuth2 == nil &&
+				(kubeconfig.BearerToken != "" || kubeconfig.BearerTokenFile != "") {
+				httpConfig.Authorization = &config.Authorization{
+					Type:            "Bearer",
+					Credentials:     config.Secret(kubeconfig.BearerToken),
+					CredentialsFile: kubeconfig.BearerTokenFile,
+				}
+			}
+			if httpConfig.TLSConfig.ServerName == "" {
+				httpConfig.TLSConfig.ServerName = fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace)
 			}
 		}
 	}
+	if c == nil {
+		c = client.NewClient(ctx, address, httpConfig, o.RequestOptions())
+	}
+	if err := c.Init(); err != nil {
+		klog.Fatal(err)
+	}
+
+	// Check if the Prometheus instance is ready.
+	err = c.IsReady(ctx)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return c
+}
+
+// restConfig returns the configuration for the cluster within the kubeconfig.
+func restConfig(o *options.Options) *rest.Config {
+	kubeconfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: o.KubeconfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: o.KubeContext},
+	).ClientConfig()
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return kubeconfig
+}
+
+// newSources sources monitors and rules from the rendered manifests if specified, and from the cluster otherwise. The
+// rules loaded by the Prometheus instance are used by default, if c is given.
+func newSources(o *options.Options, c *client.Client) sources {
+	if o.ManifestsDir != "" {
+		m, err := manifests.Load(o.ManifestsDir)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		return sources{
+			lister:        profiles.NewManifestsMonitorLister(m),
+			rulesProvider: profiles.NewManifestsRulesProvider(m, o.PromRuleNamespace, o.PromRuleSelector),
+		}
+	}
+
+	// Create a new Kube client.
+	dc, err := dynamic.NewForConfig(restConfig(o))
+	if err != nil {
+		klog.Fatal(err)
+	}
+	s := sources{
+		lister: profiles.NewClusterMonitorLister(dc),
+		dc:     dc,
+	}
+	if c != nil {
+		s.rulesProvider = c
+	}
+	if o.PrometheusRules {
+		s.rulesProvider = profiles.NewClusterRulesProvider(dc, o.PromRuleNamespace, o.PromRuleSelector)
+	}
+
+	return s
 }
@@ -0,0 +1,308 @@
+// Package cpv exposes the validation, extraction and implementation status of collection profiles to programs that
+// embed cpv, for eg., operators. Unlike the command, the library never exits, writes no files and registers no flags:
+// all results are returned as reports, which may be inspected, or rendered in any of the supported formats.
+package cpv
+
+import (
+	"context"
+	"errors"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/rexagod/cpv/internal/client"
+	"github.com/rexagod/cpv/internal/profiles"
+	"github.com/rexagod/cpv/internal/report"
+)
+
+type (
+
+	// CollectionProfile is the name of a collection profile, as set on the opt-in label of the monitors.
+	CollectionProfile = profiles.CollectionProfile
+
+	// Profile is the definition of a collection profile, see RegisterProfile.
+	Profile = profiles.Profile
+
+	// Source is a kind of source that profiles define their required metrics with.
+	Source = profiles.Source
+
+	// MonitorLister lists the ServiceMonitors and PodMonitors that match a label selector.
+	MonitorLister = profiles.MonitorLister
+
+	// RulesProvider provides the rule groups that are validated against a profile.
+	RulesProvider = profiles.RulesProvider
+
+	// MetadataProvider looks up the targets discovered by the Prometheus instance, and the metadata of the metrics they
+	// expose.
+	MetadataProvider = client.MetadataProvider
+
+	// MetricSource is a source of the metrics that a profile requires.
+	MetricSource = profiles.MetricSource
+
+	// CardinalityOptions control how the cardinalities are queried.
+	CardinalityOptions = client.CardinalityOptions
+
+	// CardinalValue is the cardinality of a metric, or the error encountered while evaluating it.
+	CardinalValue = client.CardinalValue
+
+	// CardinalityRange summarizes the cardinality of a metric over the lookback window, see CardinalValue.
+	CardinalityRange = client.CardinalityRange
+
+	// ValidationResult has the reports generated by validating a profile.
+	ValidationResult = profiles.ValidationResult
+
+	// ExtractResult has the reports and manifests generated by extracting a profile.
+	ExtractResult = profiles.ExtractResult
+
+	// Report is a versioned report, identified by its kind.
+	Report = report.Report
+
+	// Format is the format that reports are rendered in by Report.Write.
+	Format = report.Format
+
+	// Kind identifies what a Report has.
+	Kind = report.Kind
+
+	// Discrepancy is a metric used within a rule that is not loaded, while a monitor endpoint depends on it, or that no
+	// monitor endpoint keeps.
+	Discrepancy = report.Discrepancy
+
+	// StatusRow is a default monitor that lacks its profile-specific counterpart.
+	StatusRow = report.StatusRow
+
+	// Metric is an extracted metric, along with its cardinality, if evaluated.
+	Metric = report.Metric
+
+	// MetricCardinalityRange summarizes the cardinality of a Metric over the lookback window.
+	MetricCardinalityRange = report.CardinalityRange
+
+	// Label is a label of a Metric, along with its cardinality, and whether any source references it.
+	Label = report.Label
+
+	// Provenance is where a source found a Metric.
+	Provenance = report.Provenance
+
+	// RuleDependency is a recording rule whose inputs are absent, or that is part of a dependency cycle.
+	RuleDependency = report.RuleDependency
+
+	// Savings are the projected savings of a profile, within a savings report.
+	Savings = report.Savings
+
+	// SavingsRow is the projected savings of a monitor, a namespace, or all of them.
+	SavingsRow = report.SavingsRow
+)
+
+const (
+	FullCollectionProfile    = profiles.FullCollectionProfile
+	MinimalCollectionProfile = profiles.MinimalCollectionProfile
+
+	FormatTable = report.FormatTable
+	FormatJSON  = report.FormatJSON
+	FormatYAML  = report.FormatYAML
+
+	KindValidation  = report.KindValidation
+	KindExtraction  = report.KindExtraction
+	KindStatus      = report.KindStatus
+	KindSavings     = report.KindSavings
+	KindExplanation = report.KindExplanation
+)
+
+// DefaultCardinalityOptions are the options that cardinalities are queried with, unless set otherwise.
+var DefaultCardinalityOptions = client.DefaultCardinalityOptions
+
+var (
+
+	// errNoAPI is returned by New if no API is given to query the Prometheus instance with.
+	errNoAPI = errors.New("an API for the Prometheus instance is required")
+
+	// errNoLister is returned by the operations that need monitors, if no lister was given to New.
+	errNoLister = errors.New("a monitor lister is required")
+)
+
+// CPV validates, extracts and reports the implementation status of collection profiles, against a Prometheus instance,
+// and the monitors and rules provided to it.
+type CPV struct {
+	client        *client.Client
+	lister        MonitorLister
+	rulesProvider RulesProvider
+}
+
+// New returns a CPV that queries the Prometheus instance through api. The monitors are listed by lister, the rules
+// validated against a profile are provided by rulesProvider, and the targets, along with the metadata of the metrics
+// they expose, are looked up through metadata. If rulesProvider or metadata are nil, the rules loaded by the Prometheus
+// instance, or its targets metadata API, respectively, are used through api instead. If lister is nil, the
+// operations that need monitors return an error, except for extraction, which then generates no monitors.
+func New(api v1.API, lister MonitorLister, rulesProvider RulesProvider, metadata MetadataProvider) (*CPV, error) {
+	if api == nil {
+		return nil, errNoAPI
+	}
+	c := client.NewClientForAPI(api, metadata)
+	if rulesProvider == nil {
+		rulesProvider = c
+	}
+
+	return &CPV{
+		client:        c,
+		lister:        lister,
+		rulesProvider: rulesProvider,
+	}, nil
+}
+
+// SetCardinalityOptions sets the options that cardinalities are queried with.
+func (v *CPV) SetCardinalityOptions(options CardinalityOptions) {
+	v.client.SetCardinalityOptions(options)
+}
+
+// Validate checks that the metrics the rules depend on are not dropped by the monitors of the profile, and projects the
+// savings of its implemented monitors over the default ones, if savings is set.
+func (v *CPV) Validate(ctx context.Context, profile CollectionProfile, savings bool) (*ValidationResult, error) {
+	if v.lister == nil {
+		return nil, errNoLister
+	}
+	op, err := profiles.ProfileOperator(profile)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	//nolint:wrapcheck
+	return op.Operator(ctx, v.lister, v.rulesProvider, v.client, false, savings)
+}
+
+// ExtractOptions control what is evaluated when extracting a profile, on top of the metrics it requires.
+type ExtractOptions struct {
+
+	// OutputCardinality evaluates the cardinality of every extracted metric.
+	OutputCardinality bool
+
+	// LabelCardinality breaks every extracted metric down by label, and suggests the labels that may be dropped.
+	LabelCardinality bool
+
+	// Savings projects the savings of the generated monitors over the default ones.
+	Savings bool
+}
+
+// Extract returns the metrics that the sources require for the profile, along with the relabel config that keeps them,
+// and the profile-specific counterparts of the default monitors, if a lister was given.
+func (v *CPV) Extract(ctx context.Context, profile CollectionProfile, sources []MetricSource, options ExtractOptions) (*ExtractResult, error) {
+	e, err := profiles.ProfileExtractor(profile)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	//nolint:wrapcheck
+	return e.Extract(ctx, v.client, profiles.ExtractRequest{
+		Sources:           sources,
+		Lister:            v.lister,
+		OutputCardinality: options.OutputCardinality,
+		LabelCardinality:  options.LabelCardinality,
+		Savings:           options.Savings,
+	})
+}
+
+// Explain returns where the sources of the profile found the metric, i.e., why it is extracted.
+func (v *CPV) Explain(ctx context.Context, profile CollectionProfile, sources []MetricSource, metric string) (*Report, error) {
+	e, err := profiles.ProfileExtractor(profile)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	//nolint:wrapcheck
+	return e.Explain(ctx, v.client, sources, metric)
+}
+
+// Status returns the default monitors that have no counterpart implementing the profile, or any of the registered
+// ones, if profile is empty.
+func (v *CPV) Status(ctx context.Context, profile CollectionProfile) (*Report, error) {
+	if v.lister == nil {
+		return nil, errNoLister
+	}
+
+	//nolint:wrapcheck
+	return profiles.ReportImplementationStatus(ctx, v.lister, profile, false)
+}
+
+// Monitors returns the pod and service monitors that implement the profile, or any profile, if profile is empty.
+func (v *CPV) Monitors(ctx context.Context, profile CollectionProfile) (*monitoringv1.PodMonitorList, *monitoringv1.ServiceMonitorList, error) {
+	if v.lister == nil {
+		return nil, nil, errNoLister
+	}
+
+	//nolint:wrapcheck
+	return profiles.FetchMonitorsForProfile(ctx, v.lister, profile, false)
+}
+
+// Cardinalities returns the cardinality of every metric, sorted by cardinality in descending order.
+func (v *CPV) Cardinalities(ctx context.Context, metrics []string) []CardinalValue {
+	metricSet := sets.New(metrics...)
+
+	return v.client.EvaluateCardinalities(ctx, &metricSet)
+}
+
+// RegisterProfile registers a profile, which may then be validated, extracted and reported the status of, in the same
+// way as the built-in ones. It is safe to call concurrently with the rest of the package.
+func RegisterProfile(p Profile) error {
+	//nolint:wrapcheck
+	return profiles.RegisterProfile(p)
+}
+
+// LookupProfile returns the registered profile with the given name.
+func LookupProfile(name CollectionProfile) (*Profile, error) {
+	//nolint:wrapcheck
+	return profiles.LookupProfile(name)
+}
+
+// NewAllowListSource returns a source of the metrics within the allow-list file.
+//
+//nolint:ireturn
+func NewAllowListSource(file string) MetricSource {
+	return profiles.NewAllowListSource(file)
+}
+
+// NewRuleFilesSource returns a source of the scraped metrics that the rules within the rule files depend on.
+//
+//nolint:ireturn
+func NewRuleFilesSource(files []string) MetricSource {
+	return profiles.NewRuleFilesSource(files)
+}
+
+// NewDashboardsSource returns a source of the metrics used within the Grafana dashboards at the given paths.
+//
+//nolint:ireturn
+func NewDashboardsSource(paths []string) MetricSource {
+	return profiles.NewDashboardsSource(paths)
+}
+
+// NewTelemetrySource returns a source of the metrics selected by the telemetry config at file, or within the ConfigMap
+// (<namespace>/<name>) in the cluster that dc points to.
+//
+//nolint:ireturn
+func NewTelemetrySource(dc dynamic.Interface, file, configMap string) MetricSource {
+	return profiles.NewTelemetrySource(dc, file, configMap)
+}
+
+// NewTargetsSource returns a source of the metrics exposed by all targets that match the series selector.
+//
+//nolint:ireturn
+func NewTargetsSource(selector string) MetricSource {
+	return profiles.NewTargetsSource(selector)
+}
+
+// NewClusterMonitorLister returns a MonitorLister backed by the cluster that dc points to.
+//
+//nolint:ireturn
+func NewClusterMonitorLister(dc dynamic.Interface) MonitorLister {
+	return profiles.NewClusterMonitorLister(dc)
+}
+
+// NewClusterRulesProvider returns a RulesProvider backed by the PrometheusRules within the cluster that dc points to,
+// filtered by namespace (all namespaces if empty) and label selector.
+//
+//nolint:ireturn
+func NewClusterRulesProvider(dc dynamic.Interface, namespace, labelSelector string) RulesProvider {
+	return profiles.NewClusterRulesProvider(dc, namespace, labelSelector)
+}
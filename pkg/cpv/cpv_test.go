@@ -0,0 +1,68 @@
+package cpv_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rexagod/cpv/pkg/cpv"
+)
+
+func TestRegisterProfileConcurrently(t *testing.T) {
+	t.Parallel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		name := cpv.CollectionProfile(fmt.Sprintf("concurrent-%d", i))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- cpv.RegisterProfile(cpv.Profile{Name: name})
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = cpv.LookupProfile(name)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < cap(errs); i++ {
+		name := cpv.CollectionProfile(fmt.Sprintf("concurrent-%d", i))
+		p, err := cpv.LookupProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Suffix != "-"+string(name) {
+			t.Errorf("expected the suffix to default to -%s, got %s", name, p.Suffix)
+		}
+	}
+}
+
+func TestReportTypes(t *testing.T) {
+	t.Parallel()
+
+	// Importers should be able to name the types nested within a report.
+	endpoint := 0
+	r := cpv.Report{
+		Kind:          cpv.KindValidation,
+		Discrepancies: []cpv.Discrepancy{{Monitor: "openshift-monitoring/node-exporter", Endpoint: &endpoint}},
+		Status:        []cpv.StatusRow{{Profile: string(cpv.MinimalCollectionProfile)}},
+		Metrics: []cpv.Metric{{
+			Name:       "up",
+			Range:      &cpv.MetricCardinalityRange{Max: 1},
+			Labels:     []cpv.Label{{Name: "job"}},
+			Provenance: []cpv.Provenance{{Source: "rules"}},
+		}},
+		RuleDependencies: []cpv.RuleDependency{{RecordingRule: "job:up:sum"}},
+		Savings:          &cpv.Savings{Total: cpv.SavingsRow{FullSeries: 2, ProfileSeries: 1}},
+	}
+	if got := r.Savings.Total.SavedSeries(); got <= 0 {
+		t.Errorf("expected savings, got %v", got)
+	}
+}
@@ -0,0 +1,110 @@
+// Package tests runs cpv end to end, through its library API, against a fake Prometheus instance and a fake cluster.
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/rexagod/cpv/internal/fake"
+	"github.com/rexagod/cpv/pkg/cpv"
+)
+
+// fixtures is the directory of the fixtures shared with the unit tests of the profiles.
+var fixtures = filepath.Join("..", "internal", "profiles", "testdata")
+
+// newCPV returns a CPV for the fake Prometheus instance, that lists the monitors and rules within the fake cluster.
+func newCPV(t *testing.T) *cpv.CPV {
+	t.Helper()
+
+	p := fake.NewPrometheus(t, filepath.Join(fixtures, "prometheus.yaml"))
+	client, err := api.NewClient(api.Config{Address: p.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := fake.NewDynamicClient(t, filepath.Join(fixtures, "manifests", "monitors.yaml"), filepath.Join(fixtures, "manifests", "prometheusrules.yaml"))
+	c, err := cpv.New(
+		v1.NewAPI(client),
+		cpv.NewClusterMonitorLister(dc),
+		cpv.NewClusterRulesProvider(dc, "openshift-monitoring", "app.kubernetes.io/part-of=openshift-monitoring"),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	result, err := newCPV(t).Validate(context.Background(), cpv.MinimalCollectionProfile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discrepancies := result.Report.Discrepancies
+	if len(discrepancies) != 1 {
+		t.Fatalf("expected 1 discrepancy, got %d: %+v", len(discrepancies), discrepancies)
+	}
+	if d := discrepancies[0]; d.Metric != "kube_pod_container_status_restarts_total" ||
+		d.Monitor != "kube-state-metrics-minimal" ||
+		d.File != "openshift-monitoring/kube-state-metrics-rules" {
+		t.Errorf("unexpected discrepancy: %+v", d)
+	}
+	if result.Savings == nil || result.Savings.Savings.Total.FullSeries == 0 {
+		t.Errorf("expected the savings to be projected, got: %+v", result.Savings)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	r, err := newCPV(t).Status(context.Background(), cpv.MinimalCollectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, row := range r.Status {
+		got[row.ServiceMonitor+row.PodMonitor] = true
+	}
+	if len(got) != 2 || !got["node-exporter"] || !got["etcd"] {
+		t.Errorf("expected node-exporter and etcd to not implement the profile, got: %+v", r.Status)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	c := newCPV(t)
+	sources := []cpv.MetricSource{cpv.NewRuleFilesSource([]string{filepath.Join(fixtures, "rules.yaml")})}
+	result, err := c.Extract(context.Background(), cpv.MinimalCollectionProfile, sources, cpv.ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Report.Metrics) != 5 {
+		t.Errorf("expected 5 metrics to be extracted, got: %+v", result.Report.Metrics)
+	}
+	if len(result.Monitors) != 3 {
+		t.Errorf("expected 3 monitors to be generated, got %d", len(result.Monitors))
+	}
+
+	r, err := c.Explain(context.Background(), cpv.MinimalCollectionProfile, sources, "node_cpu_seconds_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provenance := r.Metrics[0].Provenance; len(provenance) != 2 || provenance[1].ReferencedBy() != "node/NodeCPUHigh -> instance:node_cpu_utilisation:rate5m" {
+		t.Errorf("unexpected provenance: %+v", provenance)
+	}
+}
+
+func TestNewWithoutAPI(t *testing.T) {
+	t.Parallel()
+
+	if _, err := cpv.New(nil, nil, nil, nil); err == nil {
+		t.Fatal("expected an error without an API")
+	}
+}